@@ -2,8 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/thewh1teagle/sona/internal/audio"
@@ -23,7 +27,7 @@ func newRootCommand() *cobra.Command {
 		Version: version,
 	}
 	rootCmd.PersistentFlags().BoolVarP(&a.verbose, "verbose", "v", false, "show ffmpeg and whisper/ggml logs")
-	rootCmd.AddCommand(a.newTranscribeCommand(), a.newServeCommand(), newPullCommand(), newDevicesCommand())
+	rootCmd.AddCommand(a.newTranscribeCommand(), a.newServeCommand(), newPullCommand(), newDevicesCommand(), newInspectCommand(), newQuantizeCommand(), a.newProbeCommand())
 	return rootCmd
 }
 
@@ -31,8 +35,12 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 	var language, prompt string
 	var translate, detectLanguage bool
 	var enhanceAudio, wordTimestamps bool
-	var threads, maxTextCtx, maxSegmentLen, bestOf, beamSize, gpuDevice int
-	var temperature float32
+	var threads, maxTextCtx, maxSegmentLen, bestOf, beamSize, gpuDevice, audioCtx, parallelChunks, audioStream int
+	var flashAttn, singleSegment, showStats bool
+	var temperature, hotwordBoost float32
+	var hotwords, suppressWords, audioFilters []string
+	var suppressRegex, dtw, channels string
+	var offset, duration, chunkLength float64
 
 	cmd := &cobra.Command{
 		Use:   "transcribe <model.bin> <audio.wav>",
@@ -43,21 +51,75 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 			audioPath := args[1]
 			audio.SetVerbose(a.verbose)
 			whisper.SetVerbose(a.verbose)
+			if channels != "mix" && channels != "split" {
+				return fmt.Errorf("--channels must be mix or split, got %q", channels)
+			}
+			if audioCtx < 0 || audioCtx > whisper.MaxAudioCtx {
+				return fmt.Errorf("--audio-ctx must be from 0 to %d, got %d", whisper.MaxAudioCtx, audioCtx)
+			}
+			split := channels == "split"
+			if split && chunkLength > 0 {
+				return errors.New("--channels split cannot be combined with --chunk-length")
+			}
 
-			samples, err := audio.ReadFileWithOptions(audioPath, audio.ReadOptions{
-				EnhanceAudio: enhanceAudio,
-			})
+			filters, err := audio.ParseFilters(strings.Join(audioFilters, ","))
+			if err != nil {
+				return err
+			}
+			readOpts := audio.ReadOptions{
+				Offset:   offset,
+				Duration: duration,
+				Filters:  filters,
+			}
+			if audioStream >= 0 {
+				readOpts.AudioTrack = audioStream + 1
+			}
+			start := time.Now()
+			var samples []float32
+			var channelSamples [][]float32
+			var channelNumbers []int
+			var stream *audio.Stream
+			if chunkLength > 0 {
+				stream, err = audio.OpenStream(cmd.Context(), audioPath, readOpts)
+			} else if split {
+				channelSamples, channelNumbers, err = audio.ReadFileChannels(cmd.Context(), audioPath, readOpts)
+				if err == nil && len(channelSamples) > 0 {
+					samples = channelSamples[0] // for the duration stats
+				}
+			} else {
+				samples, err = audio.ReadFileWithOptions(cmd.Context(), audioPath, readOpts)
+			}
 			if err != nil {
 				return fmt.Errorf("error reading audio: %w", err)
 			}
+			if stream != nil {
+				defer stream.Close()
+			}
+			audioDuration := float64(len(samples)) / audio.SampleRate
+			// Timestamps are not printed, so the cut maps are not needed.
+			if enhanceAudio {
+				switch {
+				case stream != nil:
+					stream.RemoveSilence()
+				case split:
+					channelSamples, _ = audio.RemoveSilenceChannels(channelSamples)
+				default:
+					samples, _ = audio.RemoveSilence(samples)
+				}
+			}
+			decodeTime := time.Since(start)
 
-			ctx, err := whisper.New(modelPath, gpuDevice, false)
+			ctx, err := whisper.New(modelPath, whisper.ContextOptions{
+				GPUDevice: gpuDevice,
+				FlashAttn: flashAttn,
+				DTW:       dtw,
+			})
 			if err != nil {
 				return fmt.Errorf("error loading model: %w", err)
 			}
 			defer ctx.Close()
 
-			result, err := ctx.Transcribe(samples, whisper.TranscribeOptions{
+			opts := whisper.TranscribeOptions{
 				Language:       language,
 				DetectLanguage: detectLanguage,
 				Translate:      translate,
@@ -70,18 +132,65 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 				MaxSegmentLen:  maxSegmentLen,
 				BestOf:         bestOf,
 				BeamSize:       beamSize,
-			})
+				Hotwords:       hotwords,
+				HotwordBoost:   hotwordBoost,
+				SuppressWords:  suppressWords,
+				SuppressRegex:  suppressRegex,
+				TimeOffset:     offset,
+				AudioCtx:       audioCtx,
+				SingleSegment:  singleSegment,
+				ParallelChunks: parallelChunks,
+			}
+
+			transcribeStart := time.Now()
+			var result whisper.TranscribeResult
+			if stream != nil {
+				// Print segments as each chunk finishes.
+				chunker := audio.NewChunker(stream, chunkLength)
+				result, err = whisper.TranscribeChunks(ctx, chunker, opts, whisper.StreamCallbacks{
+					OnSegment: func(seg whisper.Segment) { fmt.Print(seg.Text) },
+				})
+				fmt.Println()
+				decodeTime += chunker.DecodeTime()
+				transcribeStart = transcribeStart.Add(chunker.DecodeTime())
+				audioDuration = chunker.Consumed()
+			} else if split {
+				result, err = whisper.TranscribeChannels(ctx, channelSamples, channelNumbers, opts, whisper.StreamCallbacks{})
+				if err == nil {
+					for _, seg := range result.Segments {
+						fmt.Printf("[channel %d] %s\n", seg.Channel, strings.TrimSpace(seg.Text))
+					}
+				}
+			} else {
+				result, err = ctx.Transcribe(samples, opts)
+				if err == nil {
+					fmt.Println(result.Text())
+				}
+			}
 			if err != nil {
 				return fmt.Errorf("error transcribing: %w", err)
 			}
-			fmt.Println(result.Text())
+			if showStats {
+				transcribeTime := time.Since(transcribeStart)
+				printStats(os.Stderr, transcribeStats{
+					audioDuration: audioDuration,
+					audioDecode:   decodeTime,
+					transcribe:    transcribeTime,
+					total:         decodeTime + transcribeTime, // excludes model load
+
+					gpu:     ctx.UsesGPU(),
+					whisper: result.Timings,
+				})
+			}
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&language, "language", "l", "", "language code (e.g. en, he); empty uses whisper.cpp default (en)")
 	cmd.Flags().BoolVar(&detectLanguage, "detect-language", false, "auto-detect language")
-	cmd.Flags().BoolVar(&enhanceAudio, "enhance-audio", false, "clean audio with ffmpeg before transcription (slower, can reduce repeats)")
+	cmd.Flags().IntVar(&audioStream, "audio-stream", -1, "index of the audio stream to transcribe, as listed by probe (-1 = ffmpeg's default)")
+	cmd.Flags().StringArrayVar(&audioFilters, "audio-filter", nil, "preprocessing step or comma-separated chain, e.g. highpass=f=80 (repeatable; "+strings.Join(audio.FilterNames(), ", ")+")")
+	cmd.Flags().BoolVar(&enhanceAudio, "enhance-audio", false, "shorten long silences before transcription (can reduce repeats)")
 	cmd.Flags().BoolVar(&translate, "translate", false, "translate to English")
 	cmd.Flags().IntVar(&threads, "threads", 0, "CPU threads (0 = default)")
 	cmd.Flags().StringVar(&prompt, "prompt", "", "initial prompt / vocabulary hint")
@@ -92,13 +201,64 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 	cmd.Flags().IntVar(&bestOf, "best-of", 0, "greedy sampling: top candidates (0 = default)")
 	cmd.Flags().IntVar(&beamSize, "beam-size", 0, "beam search: beam width (0 = default)")
 	cmd.Flags().IntVar(&gpuDevice, "gpu-device", -1, "GPU device index (-1 = whisper default)")
+	cmd.Flags().StringSliceVar(&hotwords, "hotword", nil, "word or phrase to bias decoding towards (repeatable)")
+	cmd.Flags().Float32Var(&hotwordBoost, "hotword-boost", 0, "logit boost for hotwords (0 = default)")
+	cmd.Flags().StringSliceVar(&suppressWords, "suppress-word", nil, "word or phrase to never emit (repeatable)")
+	cmd.Flags().StringVar(&suppressRegex, "suppress-regex", "", "regex of tokens to suppress")
+	cmd.Flags().Float64Var(&offset, "offset", 0, "start transcribing this many seconds into the audio")
+	cmd.Flags().Float64Var(&duration, "duration", 0, "seconds of audio to transcribe after --offset (0 = until end)")
+	cmd.Flags().Float64Var(&chunkLength, "chunk-length", 0, "decode and transcribe long audio in chunks of this many seconds (0 = all at once)")
+	cmd.Flags().StringVar(&channels, "channels", "mix", "mix: downmix to mono; split: transcribe each channel on its own and label segments by channel")
+	cmd.Flags().IntVar(&parallelChunks, "parallel-chunks", 0, "split audio at silence and transcribe this many chunks concurrently (0 = off)")
+	cmd.Flags().IntVar(&audioCtx, "audio-ctx", 0, "encoder audio context size (0 = model default; smaller is faster)")
+	cmd.Flags().BoolVar(&singleSegment, "single-segment", false, "force a single output segment")
+	cmd.Flags().BoolVar(&flashAttn, "flash-attn", false, "enable flash attention")
+	cmd.Flags().StringVar(&dtw, "dtw", "", "DTW token timestamps with an alignment-heads preset (auto, "+strings.Join(whisper.DTWPresets, ", ")+")")
+	cmd.Flags().BoolVar(&showStats, "stats", false, "print timing and performance stats to stderr")
 	return cmd
 }
 
+// transcribeStats mirrors the usage and timings the server reports.
+type transcribeStats struct {
+	audioDuration float64
+	audioDecode   time.Duration
+	transcribe    time.Duration
+	total         time.Duration
+	gpu           bool
+	whisper       whisper.Timings
+}
+
+func printStats(w io.Writer, st transcribeStats) {
+	rtf := 0.0
+	if st.audioDuration > 0 {
+		rtf = st.total.Seconds() / st.audioDuration
+	}
+	fmt.Fprintf(w, "audio duration:   %.2fs\n", st.audioDuration)
+	fmt.Fprintf(w, "real-time factor: %.3f\n", rtf)
+	fmt.Fprintf(w, "gpu:              %t\n", st.gpu)
+	fmt.Fprintf(w, "audio decode:     %.1f ms\n", msOf(st.audioDecode))
+	fmt.Fprintf(w, "transcribe:       %.1f ms\n", msOf(st.transcribe))
+	if st.whisper.Runs > 0 { // per call, as whisper.cpp reports them
+		fmt.Fprintf(w, "  sample (avg):   %.1f ms\n", st.whisper.SampleAvgMs)
+		fmt.Fprintf(w, "  encode (avg):   %.1f ms\n", st.whisper.EncodeAvgMs)
+		fmt.Fprintf(w, "  decode (avg):   %.1f ms\n", st.whisper.DecodeAvgMs)
+		fmt.Fprintf(w, "  batchd (avg):   %.1f ms\n", st.whisper.BatchdAvgMs)
+		fmt.Fprintf(w, "  prompt (avg):   %.1f ms\n", st.whisper.PromptAvgMs)
+	}
+	fmt.Fprintf(w, "total:            %.1f ms\n", msOf(st.total))
+}
+
+func msOf(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
 func (a *app) newServeCommand() *cobra.Command {
 	var host string
-	var port int
-	var exitWithParent bool
+	var port, sessionTokens int
+	var exitWithParent, flashAttn bool
+	var sessionTTL, decodeTimeout, diarizeTimeout, transcribeTimeout, maxAudioDuration time.Duration
+	var maxSamples int64
+	var allowPaths []string
 
 	cmd := &cobra.Command{
 		Use:   "serve [model.bin]",
@@ -115,10 +275,18 @@ func (a *app) newServeCommand() *cobra.Command {
 			s := server.New(a.verbose)
 			s.Version = version
 			s.Commit = commit
+			s.SessionTokens = sessionTokens
+			s.SessionTTL = sessionTTL
+			s.AllowedPaths = allowPaths
+			s.DecodeTimeout = decodeTimeout
+			s.DiarizeTimeout = diarizeTimeout
+			s.TranscribeTimeout = transcribeTimeout
+			s.MaxAudioDuration = maxAudioDuration
+			s.MaxSamples = maxSamples
 
 			// Load initial model if provided.
 			if len(args) > 0 {
-				if err := s.LoadModel(args[0], -1, false); err != nil {
+				if err := s.LoadModel(args[0], whisper.ContextOptions{GPUDevice: -1, FlashAttn: flashAttn}); err != nil {
 					return fmt.Errorf("error loading model: %w", err)
 				}
 			}
@@ -130,6 +298,15 @@ func (a *app) newServeCommand() *cobra.Command {
 	cmd.Flags().StringVar(&host, "host", "127.0.0.1", "host to bind to")
 	cmd.Flags().IntVarP(&port, "port", "p", 0, "port to listen on (0 = auto-assign)")
 	cmd.Flags().BoolVar(&exitWithParent, "exit-with-parent", true, "exit when the parent process exits")
+	cmd.Flags().BoolVar(&flashAttn, "flash-attn", false, "enable flash attention for the initial model")
+	cmd.Flags().IntVar(&sessionTokens, "session-tokens", 224, "output tokens a session_id carries into its next request")
+	cmd.Flags().DurationVar(&sessionTTL, "session-ttl", 10*time.Minute, "forget session_id context after this much idle time")
+	cmd.Flags().StringArrayVar(&allowPaths, "allow-path", nil, "directory whose files requests may read with file_path (repeatable)")
+	cmd.Flags().DurationVar(&decodeTimeout, "decode-timeout", 0, "fail a request whose audio takes longer to decode (0 = no limit)")
+	cmd.Flags().DurationVar(&diarizeTimeout, "diarize-timeout", 0, "skip speaker labels when diarization takes longer (0 = no limit)")
+	cmd.Flags().DurationVar(&transcribeTimeout, "transcribe-timeout", 0, "abort a transcription that takes longer (0 = no limit)")
+	cmd.Flags().DurationVar(&maxAudioDuration, "max-audio-duration", 0, "reject audio that decodes to more than this (0 = no limit)")
+	cmd.Flags().Int64Var(&maxSamples, "max-samples", 0, "reject audio that decodes to more than this many 16kHz samples, summed over all channels (0 = no limit)")
 	return cmd
 }
 
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/thewh1teagle/sona/internal/ggml"
+)
+
+func newInspectCommand() *cobra.Command {
+	var withHash bool
+
+	cmd := &cobra.Command{
+		Use:   "inspect <model.bin>",
+		Short: "Show model metadata without loading it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return inspectModel(args[0], withHash)
+		},
+	}
+	cmd.Flags().BoolVar(&withHash, "sha256", false, "also compute the file's SHA-256 (reads the whole file)")
+	return cmd
+}
+
+func inspectModel(path string, withHash bool) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	info, err := ggml.InspectFile(path)
+	if err != nil {
+		return fmt.Errorf("invalid model %s: %w", path, err)
+	}
+
+	out := map[string]any{
+		"path":     path,
+		"size":     st.Size(),
+		"modified": st.ModTime().UTC().Format(time.RFC3339),
+		"model":    info,
+	}
+	if withHash {
+		sum, err := ggml.FileSHA256(path)
+		if err != nil {
+			return fmt.Errorf("hash model file: %w", err)
+		}
+		out["sha256"] = sum
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thewh1teagle/sona/internal/audio"
+)
+
+func (a *app) newProbeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "probe <media>",
+		Short: "Show a media file's container and audio streams (needs ffprobe)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			audio.SetVerbose(a.verbose)
+			result, err := audio.ProbeFile(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(result)
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/thewh1teagle/sona/internal/ggml"
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func newQuantizeCommand() *cobra.Command {
+	var quantType string
+
+	cmd := &cobra.Command{
+		Use:   "quantize <in.bin> <out.bin>",
+		Short: "Quantize a model file",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return quantizeModel(args[0], args[1], quantType)
+		},
+	}
+	cmd.Flags().StringVarP(&quantType, "type", "t", "q5_0", "quantization type ("+strings.Join(ggml.QuantTypeNames(), ", ")+")")
+	return cmd
+}
+
+func quantizeModel(inPath, outPath, quantType string) error {
+	if _, err := ggml.ParseQuantType(quantType); err != nil {
+		return err
+	}
+	inInfo, err := os.Stat(inPath)
+	if err != nil {
+		return err
+	}
+
+	tmp := outPath + ".part"
+	quantized := 0
+	err = whisper.QuantizeModel(inPath, tmp, quantType, func(p whisper.QuantizeProgress) {
+		if p.Quantized {
+			quantized++
+		}
+		fmt.Printf("\rquantizing tensor %d (%d quantized) %-48s", p.Index+1, quantized, p.Tensor)
+	})
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	// Make sure whisper.cpp accepts the result before publishing it.
+	ctx, err := whisper.New(tmp, whisper.ContextOptions{GPUDevice: -1, NoGPU: true})
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("quantized model failed to load: %w", err)
+	}
+	ctx.Close()
+
+	if err := os.Rename(tmp, outPath); err != nil {
+		return fmt.Errorf("finalize output file: %w", err)
+	}
+	outInfo, err := os.Stat(outPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("saved %s (%.1f MB -> %.1f MB)\n", outPath, float64(inInfo.Size())/(1024*1024), float64(outInfo.Size())/(1024*1024))
+	return nil
+}
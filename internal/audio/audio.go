@@ -2,19 +2,29 @@ package audio
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 
 	"github.com/thewh1teagle/sona/internal/wav"
 )
 
+// SampleRate is the rate of all decoded output, as expected by whisper.
+const SampleRate = 16000
+
 var verbose bool
 
 type ReadOptions struct {
-	EnhanceAudio bool
+	Offset   float64  // seconds to skip from the start of the input
+	Duration float64  // seconds to decode after Offset (0 = until end)
+	Filters  []Filter // preprocessing steps (see ParseFilters)
+	// AudioTrack picks the input's audio stream by 1-based number (see
+	// Probe); 0 lets ffmpeg choose. Setting it always decodes with ffmpeg.
+	AudioTrack int
 }
 
 func SetVerbose(v bool) {
@@ -54,103 +64,227 @@ func findFFmpeg() (string, error) {
 }
 
 // ConvertToNativeWav converts any audio file to a 16kHz mono 16-bit PCM WAV file
-// on disk using ffmpeg. When enhanceAudio is true, a silence removal filter is applied.
-func ConvertToNativeWav(inputPath, outputPath string, enhanceAudio bool) error {
+// on disk using ffmpeg. Offset and Duration limit conversion to that time range,
+// and AudioTrack picks the stream. ffmpeg is killed if ctx is done.
+func ConvertToNativeWav(ctx context.Context, inputPath, outputPath string, opts ReadOptions) error {
 	ffmpegPath, err := findFFmpeg()
 	if err != nil {
 		return err
 	}
 
-	args := []string{
-		"-i", inputPath,
-		"-ar", "16000",
-		"-ac", "1",
-	}
-	if enhanceAudio {
-		args = append(args, "-af", "silenceremove=stop_periods=-1:stop_duration=0.7:stop_threshold=-45dB")
-	}
-	args = append(args,
+	args := append(ffmpegDecodeArgs(inputPath, opts, true),
 		"-acodec", "pcm_s16le",
 		"-y",
 		outputPath,
 	)
 
-	cmd := exec.Command(ffmpegPath, args...)
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
 	var stderrBuf bytes.Buffer
+	cmd.Stderr = ffmpegStderr(&stderrBuf)
+
+	if err := cmd.Run(); err != nil {
+		return ffmpegError(ctx, "ffmpeg WAV conversion failed", err, stderrBuf.String())
+	}
+	return nil
+}
+
+// ffmpegDecodeArgs returns the ffmpeg arguments that read inputPath and
+// resample it to 16kHz, downmixed to mono if asked, up to but excluding the
+// output format.
+func ffmpegDecodeArgs(inputPath string, opts ReadOptions, mono bool) []string {
+	var args []string
+	if opts.Offset > 0 {
+		args = append(args, "-ss", formatSeconds(opts.Offset))
+	}
+	if opts.Duration > 0 {
+		args = append(args, "-t", formatSeconds(opts.Duration))
+	}
+	args = append(args, "-i", inputPath)
+	if opts.AudioTrack > 0 {
+		args = append(args, "-map", fmt.Sprintf("0:a:%d", opts.AudioTrack-1))
+	}
+	args = append(args, "-ar", "16000")
+	if mono {
+		args = append(args, "-ac", "1")
+	}
+	if chain, _, _ := splitFilters(opts.Filters); chain != "" {
+		args = append(args, "-af", chain)
+	}
+	return args
+}
+
+// ffmpegStderr returns where ffmpeg's stderr goes: buf, and the terminal too
+// in verbose mode.
+func ffmpegStderr(buf *bytes.Buffer) io.Writer {
 	if verbose {
-		cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
-	} else {
-		cmd.Stderr = &stderrBuf
+		return io.MultiWriter(os.Stderr, buf)
 	}
+	return buf
+}
 
-	if err := cmd.Run(); err != nil {
-		stderr := stderrBuf.String()
-		if stderr != "" {
-			// Truncate stderr to avoid huge error messages
-			if len(stderr) > 500 {
-				stderr = stderr[:500] + "..."
-			}
-			return fmt.Errorf("ffmpeg WAV conversion failed: %w\nffmpeg stderr: %s", err, stderr)
+// ffmpegError describes a failed ffmpeg or ffprobe run. If ctx is done, the
+// process was killed for that reason, which is returned instead.
+func ffmpegError(ctx context.Context, msg string, err error, stderr string) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%s: %w", msg, ctxErr)
+	}
+	if stderr != "" {
+		// Truncate stderr to avoid huge error messages
+		if len(stderr) > 500 {
+			stderr = stderr[:500] + "..."
 		}
-		return fmt.Errorf("ffmpeg WAV conversion failed: %w", err)
+		return fmt.Errorf("%s: %w\nffmpeg stderr: %s", msg, err, stderr)
 	}
-	return nil
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
 }
 
 // Read decodes audio from an io.ReadSeeker into float32 samples at 16kHz mono.
 // If the input is a native 16kHz/mono/16-bit PCM WAV, it is decoded directly.
-// Otherwise, ffmpeg is used to convert the audio.
+// Other WAVs, FLAC, MP3, Ogg Vorbis and Ogg Opus are decoded and resampled in Go.
+// Anything else is piped through ffmpeg.
 func Read(r io.ReadSeeker) ([]float32, error) {
-	return ReadWithOptions(r, ReadOptions{})
+	return ReadWithOptions(context.Background(), r, ReadOptions{})
 }
 
-func ReadWithOptions(r io.ReadSeeker, opts ReadOptions) ([]float32, error) {
-	h, err := wav.ReadHeader(r)
-	if err == nil && h.IsNative() && !opts.EnhanceAudio {
-		return wav.Read(r)
+func ReadWithOptions(ctx context.Context, r io.ReadSeeker, opts ReadOptions) ([]float32, error) {
+	ffmpegChain, goSteps, err := splitFilters(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := decode(ctx, r, opts, ffmpegChain != "" || opts.AudioTrack > 0)
+	if err != nil {
+		return nil, err
 	}
+	applyFilters(newFilterChain(goSteps), samples)
+	return samples, nil
+}
 
-	// Not a native WAV (or enhancement requested) — need ffmpeg
-	r.Seek(0, io.SeekStart)
+// decode reads all of r into 16kHz mono samples, through ffmpeg if useFFmpeg
+// is set (for its filters or stream selection) or the format is not
+// decodable in Go, including when a Go decoder fails partway through.
+// Decoding stops with ctx's error when ctx is done.
+func decode(ctx context.Context, r io.ReadSeeker, opts ReadOptions, useFFmpeg bool) ([]float32, error) {
+	var decodeErr error
+	if !useFFmpeg {
+		h, err := wav.ReadHeader(r)
+		// A bounded duration streams instead, so only that much is read.
+		if err == nil && h.IsNative() && opts.Duration == 0 {
+			samples, err := wav.Read(r)
+			if err != nil {
+				return nil, err
+			}
+			return trimSamples(samples, opts.Offset, opts.Duration), nil
+		}
+		if err == nil && h.Supported() == nil {
+			s, err := openWavStream(ctx, r, opts)
+			if err != nil {
+				return nil, err
+			}
+			return readAll(s)
+		}
 
-	// Save to temp file for ffmpeg input
-	tmp, err := os.CreateTemp("", "sona-*.audio")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %w", err)
+		r.Seek(0, io.SeekStart)
+		if s := newDecoderStream(ctx, r, opts); s != nil {
+			samples, err := readAll(s)
+			s.Close()
+			if err == nil || ctx.Err() != nil {
+				return samples, err
+			}
+			// The header parsed but the body did not; ffmpeg may be more
+			// forgiving.
+			if verbose {
+				fmt.Fprintf(os.Stderr, "warning: %v, falling back to ffmpeg\n", err)
+			}
+			decodeErr = err
+		}
 	}
-	defer os.Remove(tmp.Name())
 
-	if _, err := io.Copy(tmp, r); err != nil {
-		tmp.Close()
-		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	// Not decodable in Go — pipe it through ffmpeg.
+	samples, err := decodeFFmpeg(ctx, r, opts)
+	if err != nil && decodeErr != nil {
+		return nil, fmt.Errorf("%w (ffmpeg fallback: %v)", decodeErr, err)
 	}
-	tmp.Close()
+	return samples, err
+}
 
-	// Convert to native WAV via ffmpeg
-	nativeWav := tmp.Name() + ".wav"
-	if err := ConvertToNativeWav(tmp.Name(), nativeWav, opts.EnhanceAudio); err != nil {
+// decodeFFmpeg reads all of r into 16kHz mono samples through ffmpeg.
+func decodeFFmpeg(ctx context.Context, r io.ReadSeeker, opts ReadOptions) ([]float32, error) {
+	input, stdin, cleanup, err := ffmpegInput(r)
+	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(nativeWav)
+	defer cleanup()
+	s, err := newFFmpegStream(ctx, input, stdin, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return readAll(s)
+}
 
-	f, err := os.Open(nativeWav)
+// ffmpegInput returns how ffmpeg should read r: by name if it is a file on
+// disk, else from its stdin, or from a temp file for containers it must seek
+// in. cleanup removes the temp file.
+func ffmpegInput(r io.ReadSeeker) (input string, stdin io.Reader, cleanup func(), err error) {
+	r.Seek(0, io.SeekStart)
+	if f, ok := r.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			// The file: prefix keeps names like "pipe:x" from being read as
+			// protocols.
+			return "file:" + f.Name(), nil, func() {}, nil
+		}
+	}
+	if !needsSeeking(r) {
+		return "pipe:0", r, func() {}, nil
+	}
+	// ffmpeg must seek to the trailing moov atom, so give it a file.
+	tmp, err := os.CreateTemp("", "sona-*.audio")
 	if err != nil {
-		return nil, fmt.Errorf("failed to open converted file: %w", err)
+		return "", nil, nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
-	defer f.Close()
-	return wav.Read(f)
+	cleanup = func() { os.Remove(tmp.Name()) }
+	_, err = io.Copy(tmp, r)
+	tmp.Close()
+	if err != nil {
+		cleanup()
+		return "", nil, nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	return tmp.Name(), nil, cleanup, nil
+}
+
+// trimSamples returns the [offset, offset+duration) window of 16kHz samples.
+// A zero duration keeps everything after offset.
+func trimSamples(samples []float32, offset, duration float64) []float32 {
+	start := int(offset * SampleRate)
+	if start < 0 {
+		start = 0
+	}
+	if start > len(samples) {
+		start = len(samples)
+	}
+	end := len(samples)
+	if duration > 0 {
+		if n := start + int(duration*SampleRate); n < end {
+			end = n
+		}
+	}
+	return samples[start:end]
 }
 
 // ReadFile opens an audio file by path and returns float32 samples at 16kHz mono.
 func ReadFile(path string) ([]float32, error) {
-	return ReadFileWithOptions(path, ReadOptions{})
+	return ReadFileWithOptions(context.Background(), path, ReadOptions{})
 }
 
-func ReadFileWithOptions(path string, opts ReadOptions) ([]float32, error) {
+func ReadFileWithOptions(ctx context.Context, path string, opts ReadOptions) ([]float32, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	return ReadWithOptions(f, opts)
+	return ReadWithOptions(ctx, f, opts)
 }
@@ -0,0 +1,29 @@
+package audio
+
+import "testing"
+
+func TestTrimSamples(t *testing.T) {
+	samples := make([]float32, 2*SampleRate)
+	for i := range samples {
+		samples[i] = float32(i)
+	}
+	tests := []struct {
+		name             string
+		offset, duration float64
+		start, n         int
+	}{
+		{"whole", 0, 0, 0, 2 * SampleRate},
+		{"offset", 0.5, 0, SampleRate / 2, 3 * SampleRate / 2},
+		{"window", 0.5, 1, SampleRate / 2, SampleRate},
+		{"duration past end", 1.5, 10, 3 * SampleRate / 2, SampleRate / 2},
+		{"offset at end", 2, 0, 2 * SampleRate, 0},
+		{"offset past end", 5, 1, 2 * SampleRate, 0},
+		{"negative offset", -1, 0.5, 0, SampleRate / 2},
+	}
+	for _, tt := range tests {
+		got := trimSamples(samples, tt.offset, tt.duration)
+		if len(got) != tt.n || len(got) > 0 && got[0] != float32(tt.start) {
+			t.Errorf("%s: got %d samples, want %d from sample %d", tt.name, len(got), tt.n, tt.start)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/thewh1teagle/sona/internal/resample"
+	"github.com/thewh1teagle/sona/internal/wav"
+)
+
+// ReadChannels decodes each channel of r separately into 16kHz samples, for
+// transcribing recordings that keep each party on its own channel. Channels
+// that are exact copies of an earlier one (dual mono, or mono MP3, which is
+// always decoded as stereo) are dropped, so a mono input yields one channel.
+// numbers holds the 1-based channel in r each kept channel came from.
+func ReadChannels(ctx context.Context, r io.ReadSeeker, opts ReadOptions) (chans [][]float32, numbers []int, err error) {
+	ffmpegChain, goSteps, err := splitFilters(opts.Filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	chans, numbers, err = decodeChannels(ctx, r, opts, ffmpegChain != "" || opts.AudioTrack > 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, samples := range chans {
+		applyFilters(newFilterChain(goSteps), samples)
+	}
+	return chans, numbers, nil
+}
+
+// decodeChannels is decode (see ReadWithOptions) for ReadChannels.
+func decodeChannels(ctx context.Context, r io.ReadSeeker, opts ReadOptions, useFFmpeg bool) ([][]float32, []int, error) {
+	if !useFFmpeg {
+		if h, err := wav.ReadHeader(r); err == nil && h.Supported() == nil {
+			_, dataSize, err := wav.DataChunk(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			var src io.Reader = bufio.NewReaderSize(r, 1<<16)
+			if dataSize != wav.UnknownSize {
+				src = io.LimitReader(src, dataSize)
+			}
+			return splitChannels(ctx, newWavDecoder(src, h), opts)
+		}
+		r.Seek(0, io.SeekStart)
+		dec, err := newBlockDecoder(bufio.NewReaderSize(r, 1<<16))
+		if dec != nil && err == nil {
+			return splitChannels(ctx, dec, opts)
+		}
+	}
+	return ffmpegChannels(ctx, r, opts)
+}
+
+// ReadFileChannels opens an audio file by path and decodes each channel
+// separately (see ReadChannels).
+func ReadFileChannels(ctx context.Context, path string, opts ReadOptions) ([][]float32, []int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return ReadChannels(ctx, f, opts)
+}
+
+// splitChannels drains dec into one resampled slice per distinct channel,
+// trimmed to opts.Offset and opts.Duration, with their 1-based channel
+// numbers. It stops with ctx's error when ctx is done.
+func splitChannels(ctx context.Context, dec blockDecoder, opts ReadOptions) ([][]float32, []int, error) {
+	n := dec.channels()
+	chans := make([][]float32, n)
+	rs := make([]*resample.Resampler, n)
+	for ch := range rs {
+		rs[ch] = resample.New(dec.rate(), SampleRate)
+	}
+	// Decoding stops once every channel covers the wanted range.
+	end := -1
+	if opts.Duration > 0 {
+		end = int((opts.Offset + opts.Duration) * SampleRate)
+	}
+	one := make([]float32, 0, 4096)
+	for end < 0 || len(chans[0]) < end {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		block, err := dec.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for ch := range n {
+			one = one[:0]
+			for i := ch; i < len(block); i += n {
+				one = append(one, block[i])
+			}
+			chans[ch] = rs[ch].Process(one, chans[ch])
+		}
+	}
+
+	var out [][]float32
+	var numbers []int
+	for ch := range n {
+		samples := trimSamples(rs[ch].Flush(chans[ch]), opts.Offset, opts.Duration)
+		if !slices.ContainsFunc(out, func(prev []float32) bool { return slices.Equal(prev, samples) }) {
+			out = append(out, samples)
+			numbers = append(numbers, ch+1)
+		}
+	}
+	return out, numbers, nil
+}
+
+// ffmpegChannels decodes r with ffmpeg, keeping its channel layout. ffmpeg
+// writes a WAV to its stdout so the channel count travels with the samples;
+// its header has no sizes, so the data is read until EOF.
+func ffmpegChannels(ctx context.Context, r io.ReadSeeker, opts ReadOptions) ([][]float32, []int, error) {
+	ffmpegPath, err := findFFmpeg()
+	if err != nil {
+		return nil, nil, err
+	}
+	input, stdin, cleanup, err := ffmpegInput(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+
+	args := append(ffmpegDecodeArgs(input, opts, false), "-f", "wav", "-acodec", "pcm_f32le", "-")
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = ffmpegStderr(&stderr)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	br := bufio.NewReaderSize(stdout, 1<<16)
+	h, _, err := wav.DataChunk(br)
+	var chans [][]float32
+	var numbers []int
+	if err == nil {
+		// ffmpeg already applied the offset and duration.
+		chans, numbers, err = splitChannels(ctx, newWavDecoder(br, h), ReadOptions{})
+	}
+	if err != nil {
+		cmd.Process.Kill()
+	}
+	if waitErr := cmd.Wait(); waitErr != nil {
+		return nil, nil, ffmpegError(ctx, "ffmpeg decoding failed", waitErr, stderr.String())
+	}
+	return chans, numbers, err
+}
@@ -0,0 +1,59 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/thewh1teagle/sona/internal/wav"
+)
+
+func TestReadChannels(t *testing.T) {
+	tone := sine(44100, 2*44100, 440)
+	silence := make([]float32, len(tone))
+
+	chans, numbers, err := ReadChannels(context.Background(), bytes.NewReader(stereoWAV(44100, tone, silence)), ReadOptions{Offset: 0.5, Duration: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chans) != 2 || !slices.Equal(numbers, []int{1, 2}) {
+		t.Fatalf("got %d channels numbered %v, want 2", len(chans), numbers)
+	}
+	for ch, amp := range []float64{0.5, 0} {
+		if len(chans[ch]) != SampleRate {
+			t.Fatalf("channel %d has %d samples, want %d", ch, len(chans[ch]), SampleRate)
+		}
+		for i := 200; i < SampleRate-200; i++ {
+			want := amp * math.Sin(2*math.Pi*440*(float64(i)/SampleRate+0.5))
+			if d := math.Abs(float64(chans[ch][i]) - want); d > 0.01 {
+				t.Fatalf("channel %d sample %d = %f, want %f", ch, i, chans[ch][i], want)
+			}
+		}
+	}
+
+	// Identical channels are one source.
+	chans, _, err = ReadChannels(context.Background(), bytes.NewReader(stereoWAV(44100, tone, tone)), ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chans) != 1 {
+		t.Errorf("dual mono gave %d channels, want 1", len(chans))
+	}
+
+	// A dropped copy does not renumber the channels after it.
+	var data bytes.Buffer
+	for i := range tone {
+		binary.Write(&data, binary.LittleEndian, []float32{tone[i], tone[i], -tone[i]})
+	}
+	dec := newWavDecoder(&data, wav.Header{AudioFormat: wav.FormatIEEEFloat, Channels: 3, SampleRate: 44100, BitsPerSample: 32})
+	chans, numbers, err = splitChannels(context.Background(), dec, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chans) != 2 || !slices.Equal(numbers, []int{1, 3}) {
+		t.Errorf("got %d channels numbered %v, want 1 and 3", len(chans), numbers)
+	}
+}
@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	// chunkReadSize is how many samples the Chunker reads from its stream at once.
+	chunkReadSize = 1 << 16
+	// cutWindow is the 20ms window whose energy picks a chunk's cut point.
+	cutWindow = SampleRate / 50
+	// maxCutSearch bounds how far before the nominal chunk end a cut may move.
+	maxCutSearch = 30 * SampleRate
+)
+
+// ChunkOverlap is how many seconds a Chunker chunk reaches back into the
+// previous one when no pause was found to cut at, so a word cut there is
+// also heard whole. Chunks shorter than four times this overlap by a
+// quarter of their length.
+const ChunkOverlap = 1.0
+
+// Chunker splits a Stream into consecutive chunks of about the requested
+// length. Each chunk ends in the longest pause DetectSpeech finds in its last
+// stretch, so cuts fall between words. Without a pause the cut goes at the
+// quietest 20ms window there, and the next chunk starts ChunkOverlap seconds
+// earlier; whisper.TranscribeChunks drops the doubled segments.
+// At most about two chunks of samples are held in memory.
+type Chunker struct {
+	s       *Stream
+	size    int
+	search  int
+	buf     []float32 // samples from the next chunk's start
+	pos     int64     // sample index of buf[0]
+	end     int64     // sample index of the last cut
+	eof     bool
+	decoded time.Duration
+}
+
+// NewChunker returns a Chunker yielding chunks of about chunkSeconds.
+func NewChunker(s *Stream, chunkSeconds float64) *Chunker {
+	size := max(int(chunkSeconds*SampleRate), 2*cutWindow)
+	return &Chunker{s: s, size: size, search: min(size/4, maxCutSearch)}
+}
+
+// Next returns the next chunk and its start time in seconds, or io.EOF after
+// the last chunk.
+func (c *Chunker) Next() ([]float32, float64, error) {
+	start := time.Now()
+	for !c.eof && len(c.buf) < c.size {
+		if cap(c.buf) < c.size {
+			grown := make([]float32, len(c.buf), c.size)
+			copy(grown, c.buf)
+			c.buf = grown
+		}
+		n, err := c.s.Read(c.buf[len(c.buf):min(len(c.buf)+chunkReadSize, c.size)])
+		c.buf = c.buf[:len(c.buf)+n]
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, 0, err
+		}
+	}
+	c.decoded += time.Since(start)
+	if len(c.buf) == 0 {
+		return nil, 0, io.EOF
+	}
+
+	cut, next := len(c.buf), len(c.buf)
+	if !c.eof {
+		from := max(len(c.buf)-c.search, 0)
+		if gap := speechGap(c.buf[from:]); gap >= 0 {
+			cut, next = from+gap, from+gap
+		} else {
+			cut = quietestPoint(c.buf, from, len(c.buf))
+			next = cut - min(int(ChunkOverlap*SampleRate), c.size/4)
+		}
+	}
+	chunk := c.buf[:cut]
+	c.buf = append(make([]float32, 0, c.size), c.buf[next:]...)
+	at := float64(c.pos) / SampleRate
+	c.end = c.pos + int64(cut)
+	c.pos += int64(next)
+	return chunk, at, nil
+}
+
+// Duration returns the total input length in seconds, or 0 if unknown.
+func (c *Chunker) Duration() float64 {
+	return float64(c.s.Total()) / SampleRate
+}
+
+// Consumed returns the seconds of audio returned by Next so far.
+func (c *Chunker) Consumed() float64 {
+	return float64(c.end) / SampleRate
+}
+
+// DecodeTime returns the time spent waiting for decoded samples so far.
+func (c *Chunker) DecodeTime() time.Duration {
+	return c.decoded
+}
+
+// SplitAtSilence divides samples into n parts of roughly equal length and
+// returns the n+1 boundaries, each inner one moved to a pause (see
+// cutPoint) near the even split. Short inputs yield fewer parts.
+func SplitAtSilence(samples []float32, n int) []int {
+	n = max(1, min(n, len(samples)/SampleRate))
+	bounds := []int{0}
+	size := len(samples) / n
+	search := min(size/4, maxCutSearch)
+	for k := 1; k < n; k++ {
+		nominal := k * size
+		cut := cutPoint(samples, nominal-search, nominal+search)
+		if cut > bounds[len(bounds)-1] {
+			bounds = append(bounds, cut)
+		}
+	}
+	return append(bounds, len(samples))
+}
+
+// cutPoint returns where to cut samples within [from, to): the middle of the
+// longest pause between speech there, or else the quietest point.
+func cutPoint(samples []float32, from, to int) int {
+	from = max(from, 0)
+	if gap := speechGap(samples[from:to]); gap >= 0 {
+		return from + gap
+	}
+	return quietestPoint(samples, from, to)
+}
+
+// quietestPoint returns the middle of the lowest-energy cutWindow within
+// samples[from:to].
+func quietestPoint(samples []float32, from, to int) int {
+	from = max(from, 0)
+	if to-from < cutWindow {
+		return to
+	}
+	best, bestEnergy := to, float32(-1)
+	for i := from; i+cutWindow <= to; i += cutWindow / 2 {
+		var energy float32
+		for _, v := range samples[i : i+cutWindow] {
+			energy += v * v
+		}
+		if bestEnergy < 0 || energy < bestEnergy {
+			best, bestEnergy = i+cutWindow/2, energy
+		}
+	}
+	return best
+}
@@ -0,0 +1,135 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestWAV writes samples as a native 16kHz mono 16-bit WAV.
+func writeTestWAV(t *testing.T, samples []float32) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	w(uint32(36 + len(samples)*2))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(SampleRate), uint32(SampleRate * 2), uint16(2), uint16(16)} {
+		w(v)
+	}
+	buf.WriteString("data")
+	w(uint32(len(samples) * 2))
+	for _, s := range samples {
+		w(int16(s * math.MaxInt16))
+	}
+	path := filepath.Join(t.TempDir(), "test.wav")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loudWithGap returns seconds of full-scale noise-like signal with a short
+// silent gap starting at gapAt seconds.
+func loudWithGap(seconds, gapAt float64) []float32 {
+	samples := make([]float32, int(seconds*SampleRate))
+	for i := range samples {
+		samples[i] = float32(math.Sin(float64(i) * 0.3))
+	}
+	gap := int(gapAt * SampleRate)
+	for i := gap; i < gap+SampleRate/10; i++ {
+		samples[i] = 0
+	}
+	return samples
+}
+
+func TestQuietestPoint(t *testing.T) {
+	samples := loudWithGap(4, 3)
+	cut := quietestPoint(samples, 2*SampleRate, 4*SampleRate)
+	if cut < 3*SampleRate || cut > 3*SampleRate+SampleRate/10 {
+		t.Errorf("quietestPoint() = %d, want inside the gap at %d", cut, 3*SampleRate)
+	}
+}
+
+func TestChunker(t *testing.T) {
+	samples := loudWithGap(10, 3.5)
+	s, err := OpenStream(context.Background(), writeTestWAV(t, samples), ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Total() != int64(len(samples)) {
+		t.Errorf("Total() = %d, want %d", s.Total(), len(samples))
+	}
+
+	c := NewChunker(s, 4)
+	var end int
+	var starts []float64
+	for {
+		chunk, start, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) > 4*SampleRate {
+			t.Errorf("chunk of %d samples exceeds the chunk size", len(chunk))
+		}
+		// A chunk starts at the previous cut, or overlaps it when there was
+		// no pause to cut at.
+		at := int(math.Round(start * SampleRate))
+		if at != end && at != end-int(ChunkOverlap*SampleRate) {
+			t.Errorf("chunk start = %v after a cut at %v", start, float64(end)/SampleRate)
+		}
+		starts = append(starts, start)
+		end = at + len(chunk)
+	}
+	if end != len(samples) || c.Consumed() != 10 {
+		t.Errorf("chunks end at %d (consumed %vs), want %d", end, c.Consumed(), len(samples))
+	}
+	// The first cut moves back from 4s into the silent gap at 3.5s; the
+	// second finds no pause, so the third chunk overlaps it.
+	if len(starts) != 3 || starts[1] < 3.5 || starts[1] > 3.6 || starts[2] > starts[1]+4-ChunkOverlap {
+		t.Errorf("chunk starts = %v, want the second at the 3.5s gap", starts)
+	}
+}
+
+func TestStreamWavOffsetDuration(t *testing.T) {
+	samples := loudWithGap(3, 1)
+	s, err := OpenStream(context.Background(), writeTestWAV(t, samples), ReadOptions{Offset: 1, Duration: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	p := make([]float32, 2*SampleRate)
+	n, err := s.Read(p)
+	if err != nil || n != SampleRate/2 {
+		t.Fatalf("Read() = %d, %v, want %d samples", n, err, SampleRate/2)
+	}
+	if p[0] != 0 {
+		t.Errorf("first sample = %v, want the silent gap at 1s", p[0])
+	}
+	if _, err := s.Read(p); err != io.EOF {
+		t.Errorf("Read() after end = %v, want io.EOF", err)
+	}
+}
+
+func TestSplitAtSilence(t *testing.T) {
+	samples := loudWithGap(10, 4.5)
+	bounds := SplitAtSilence(samples, 2)
+	if len(bounds) != 3 || bounds[0] != 0 || bounds[2] != len(samples) {
+		t.Fatalf("SplitAtSilence() = %v, want 3 boundaries spanning the input", bounds)
+	}
+	if gap := int(4.5 * SampleRate); bounds[1] < gap || bounds[1] > gap+SampleRate/10 {
+		t.Errorf("cut = %d, want inside the gap at %d", bounds[1], gap)
+	}
+	if got := SplitAtSilence(samples[:SampleRate/2], 4); len(got) != 2 {
+		t.Errorf("SplitAtSilence() of half a second = %v, want a single part", got)
+	}
+}
@@ -0,0 +1,272 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+	"github.com/pion/opus"
+	"github.com/pion/opus/pkg/oggreader"
+	"github.com/thewh1teagle/sona/internal/wav"
+)
+
+// Formats decoded in Go, without ffmpeg.
+const (
+	formatFLAC   = "flac"
+	formatMP3    = "mp3"
+	formatVorbis = "vorbis"
+	formatOpus   = "opus"
+)
+
+// blockDecoder yields decoded audio as blocks of interleaved samples at
+// rate() with channels() channels.
+type blockDecoder interface {
+	rate() int
+	channels() int
+	// next returns the next block, or io.EOF after the last one. The block
+	// holds whole frames and is only valid until the following call.
+	next() ([]float32, error)
+}
+
+// sniffFormat identifies a Go-decodable format from the first bytes of a
+// file, or returns "" if ffmpeg is needed.
+func sniffFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return formatFLAC
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return formatMP3
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && (head[1]>>1)&3 == 1:
+		// MPEG audio frame sync with layer III (AAC ADTS has layer 0).
+		return formatMP3
+	case bytes.HasPrefix(head, []byte("OggS")) && len(head) > 26:
+		// The first packet names the codec.
+		payload := head[min(len(head), 27+int(head[26])):]
+		switch {
+		case bytes.HasPrefix(payload, []byte("\x01vorbis")):
+			return formatVorbis
+		case bytes.HasPrefix(payload, []byte("OpusHead")):
+			return formatOpus
+		}
+	}
+	return ""
+}
+
+// newBlockDecoder starts decoding r if its format can be decoded in Go. It
+// returns a nil decoder when r should go to ffmpeg instead.
+func newBlockDecoder(r *bufio.Reader) (blockDecoder, error) {
+	head, _ := r.Peek(512)
+	switch format := sniffFormat(head); format {
+	case formatFLAC:
+		return newFLACDecoder(r)
+	case formatMP3:
+		return newMP3Decoder(r)
+	case formatVorbis:
+		return newVorbisDecoder(r)
+	case formatOpus:
+		return newOpusDecoder(r)
+	}
+	return nil, nil
+}
+
+type flacDecoder struct {
+	stream *flac.Stream
+	scale  float32
+	block  []float32
+}
+
+func newFLACDecoder(r io.Reader) (*flacDecoder, error) {
+	stream, err := flac.New(r)
+	if err != nil {
+		return nil, fmt.Errorf("flac: %w", err)
+	}
+	return &flacDecoder{stream: stream, scale: 1 / float32(int64(1)<<(stream.Info.BitsPerSample-1))}, nil
+}
+
+func (d *flacDecoder) rate() int     { return int(d.stream.Info.SampleRate) }
+func (d *flacDecoder) channels() int { return int(d.stream.Info.NChannels) }
+
+func (d *flacDecoder) next() ([]float32, error) {
+	f, err := d.stream.ParseNext()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("flac: %w", err)
+	}
+	d.block = d.block[:0]
+	for i := range f.Subframes[0].Samples {
+		for _, sub := range f.Subframes {
+			d.block = append(d.block, float32(sub.Samples[i])*d.scale)
+		}
+	}
+	return d.block, nil
+}
+
+type mp3Decoder struct {
+	dec   *mp3.Decoder
+	raw   []byte
+	block []float32
+}
+
+func newMP3Decoder(r io.Reader) (*mp3Decoder, error) {
+	dec, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, fmt.Errorf("mp3: %w", err)
+	}
+	return &mp3Decoder{dec: dec, raw: make([]byte, 1152*4*4)}, nil
+}
+
+func (d *mp3Decoder) rate() int     { return d.dec.SampleRate() }
+func (d *mp3Decoder) channels() int { return 2 }
+
+// next reads s16le stereo, which go-mp3 always produces, even for mono.
+func (d *mp3Decoder) next() ([]float32, error) {
+	nb, err := io.ReadFull(d.dec, d.raw)
+	if nb == 0 {
+		if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("mp3: %w", err)
+	}
+	d.block = d.block[:0]
+	for o := 0; o < nb/4*4; o += 2 { // whole stereo frames only
+		d.block = append(d.block, float32(int16(binary.LittleEndian.Uint16(d.raw[o:])))/math.MaxInt16)
+	}
+	return d.block, nil
+}
+
+type vorbisDecoder struct {
+	r   *oggvorbis.Reader
+	buf []float32
+}
+
+func newVorbisDecoder(r io.Reader) (*vorbisDecoder, error) {
+	vr, err := oggvorbis.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("vorbis: %w", err)
+	}
+	return &vorbisDecoder{r: vr, buf: make([]float32, 4096*vr.Channels())}, nil
+}
+
+func (d *vorbisDecoder) rate() int     { return d.r.SampleRate() }
+func (d *vorbisDecoder) channels() int { return d.r.Channels() }
+
+func (d *vorbisDecoder) next() ([]float32, error) {
+	n, err := d.r.Read(d.buf)
+	if n == 0 {
+		if err == nil || errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("vorbis: %w", err)
+	}
+	return d.buf[:n], nil
+}
+
+type opusDecoder struct {
+	ogg   *oggreader.OggReader
+	dec   opus.Decoder
+	chans int
+	skip  int // pre-skip frames still to drop
+	block []float32
+}
+
+func newOpusDecoder(r io.Reader) (*opusDecoder, error) {
+	ogg, head, err := oggreader.NewWith(r)
+	if err != nil {
+		return nil, fmt.Errorf("opus: %w", err)
+	}
+	if head.ChannelMap > 1 || head.Channels > 2 {
+		return nil, fmt.Errorf("opus: unsupported channel mapping family %d with %d channels", head.ChannelMap, head.Channels)
+	}
+	chans := max(1, int(head.Channels))
+	// Opus decodes natively at 16kHz, so no resampling is needed.
+	dec, err := opus.NewDecoderWithOutput(SampleRate, chans)
+	if err != nil {
+		return nil, fmt.Errorf("opus: %w", err)
+	}
+	return &opusDecoder{
+		ogg:   ogg,
+		dec:   dec,
+		chans: chans,
+		skip:  int(head.PreSkip) * SampleRate / 48000,     // pre-skip is at 48kHz
+		block: make([]float32, SampleRate*120/1000*chans), // longest packet: 120 ms
+	}, nil
+}
+
+func (d *opusDecoder) rate() int     { return SampleRate }
+func (d *opusDecoder) channels() int { return d.chans }
+
+func (d *opusDecoder) next() ([]float32, error) {
+	for {
+		packet, _, err := d.ogg.ParseNextPacket()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("opus: %w", err)
+		}
+		if bytes.HasPrefix(packet, []byte("OpusTags")) {
+			continue
+		}
+		n, err := d.dec.DecodeToFloat32(packet, d.block)
+		if err != nil {
+			return nil, fmt.Errorf("opus: %w", err)
+		}
+		skip := min(d.skip, n)
+		d.skip -= skip
+		if block := d.block[skip*d.chans : n*d.chans]; len(block) > 0 {
+			return block, nil
+		}
+	}
+}
+
+// wavDecoder decodes WAV sample data that is not read as raw s16le.
+type wavDecoder struct {
+	r     io.Reader // limited to the data chunk
+	h     wav.Header
+	raw   []byte
+	block []float32
+}
+
+func newWavDecoder(r io.Reader, h wav.Header) *wavDecoder {
+	return &wavDecoder{r: r, h: h, raw: make([]byte, 4096*h.FrameSize())}
+}
+
+func (d *wavDecoder) rate() int     { return int(d.h.SampleRate) }
+func (d *wavDecoder) channels() int { return int(d.h.Channels) }
+
+func (d *wavDecoder) next() ([]float32, error) {
+	nb, err := io.ReadFull(d.r, d.raw)
+	if nb < d.h.FrameSize() {
+		if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("wav: %w", err)
+	}
+	d.block = d.h.Decode(d.block[:0], d.raw[:nb])
+	return d.block, nil
+}
+
+// downmix averages interleaved frames of channels into mono samples,
+// appending them to dst.
+func downmix(dst, block []float32, channels int) []float32 {
+	if channels == 1 {
+		return append(dst, block...)
+	}
+	for i := 0; i+channels <= len(block); i += channels {
+		var sum float32
+		for _, v := range block[i : i+channels] {
+			sum += v
+		}
+		dst = append(dst, sum/float32(channels))
+	}
+	return dst
+}
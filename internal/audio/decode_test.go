@@ -0,0 +1,170 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+func sine(rate, n int, freq float64) []float32 {
+	s := make([]float32, n)
+	for i := range s {
+		s[i] = float32(0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return s
+}
+
+func TestSniffFormat(t *testing.T) {
+	ogg := func(payload string) []byte {
+		head := append([]byte("OggS"), make([]byte, 23)...)
+		head[26] = 1 // one lacing value
+		return append(append(head, byte(len(payload))), payload...)
+	}
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), formatFLAC},
+		{"mp3 id3", []byte("ID3\x04\x00"), formatMP3},
+		{"mp3 frame", []byte{0xFF, 0xFB, 0x90, 0x00}, formatMP3},
+		{"aac adts", []byte{0xFF, 0xF1, 0x50, 0x80}, ""},
+		{"vorbis", ogg("\x01vorbis"), formatVorbis},
+		{"opus", ogg("OpusHead"), formatOpus},
+		{"ogg flac", ogg("\x7fFLAC"), ""},
+		{"wav", []byte("RIFF\x00\x00\x00\x00WAVE"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := sniffFormat(tt.head); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// encodeFLAC encodes a stereo 16-bit FLAC with the left channel set to
+// samples and the right channel silent.
+func encodeFLAC(t *testing.T, rate int, samples []float32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := flac.NewEncoder(&buf, &meta.StreamInfo{
+		BlockSizeMin:  4096,
+		BlockSizeMax:  4096,
+		SampleRate:    uint32(rate),
+		NChannels:     2,
+		BitsPerSample: 16,
+		NSamples:      uint64(len(samples)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for off := 0; off < len(samples); off += 4096 {
+		n := min(4096, len(samples)-off)
+		left := make([]int32, n)
+		for i := range left {
+			left[i] = int32(samples[off+i] * math.MaxInt16)
+		}
+		f := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         uint16(n),
+				SampleRate:        uint32(rate),
+				Channels:          frame.ChannelsLR,
+				BitsPerSample:     16,
+			},
+		}
+		for _, ch := range [][]int32{left, make([]int32, n)} {
+			f.Subframes = append(f.Subframes, &frame.Subframe{
+				SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+				Samples:   ch,
+				NSamples:  n,
+			})
+		}
+		if err := enc.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadFLAC(t *testing.T) {
+	data := encodeFLAC(t, 44100, sine(44100, 2*44100, 440)) // 2 s
+	samples, err := ReadWithOptions(context.Background(), bytes.NewReader(data), ReadOptions{Offset: 0.5, Duration: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != SampleRate {
+		t.Fatalf("got %d samples, want %d", len(samples), SampleRate)
+	}
+	// Downmixed with a silent channel: half amplitude, phase shifted by the offset.
+	for i := 200; i < len(samples)-200; i++ {
+		want := 0.25 * math.Sin(2*math.Pi*440*(float64(i)/SampleRate+0.5))
+		if d := math.Abs(float64(samples[i]) - want); d > 0.01 {
+			t.Fatalf("sample %d = %f, want %f", i, samples[i], want)
+		}
+	}
+}
+
+func TestReadCorruptFLACFallsBackToFFmpeg(t *testing.T) {
+	t.Setenv("PATH", "")
+	t.Setenv("SONA_FFMPEG_PATH", "")
+	data := encodeFLAC(t, 44100, sine(44100, 2*44100, 440))
+	// Keep the stream header and first frames, then garble the rest.
+	for i := len(data) / 2; i < len(data); i++ {
+		data[i] = byte(i * 31)
+	}
+	_, err := ReadWithOptions(context.Background(), bytes.NewReader(data), ReadOptions{})
+	if err == nil || !strings.Contains(err.Error(), "ffmpeg fallback: ffmpeg not found") {
+		t.Fatalf("ReadWithOptions() error = %v, want the decoder error after trying ffmpeg", err)
+	}
+}
+
+// stereoWAV returns a 16-bit stereo WAV of left and right at rate.
+func stereoWAV(rate int, left, right []float32) []byte {
+	var data bytes.Buffer
+	for i := range left {
+		binary.Write(&data, binary.LittleEndian, [2]int16{int16(left[i] * math.MaxInt16), int16(right[i] * math.MaxInt16)})
+	}
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	w(uint32(36 + data.Len()))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(2), uint32(rate), uint32(rate * 4), uint16(4), uint16(16)} {
+		w(v)
+	}
+	buf.WriteString("data")
+	w(uint32(data.Len()))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadWAVStereo44k(t *testing.T) {
+	// Left channel carries the tone, right is silent.
+	tone := sine(44100, 2*44100, 440)
+	data := stereoWAV(44100, tone, make([]float32, len(tone)))
+
+	samples, err := ReadWithOptions(context.Background(), bytes.NewReader(data), ReadOptions{Offset: 0.5, Duration: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != SampleRate {
+		t.Fatalf("got %d samples, want %d", len(samples), SampleRate)
+	}
+	for i := 200; i < len(samples)-200; i++ {
+		want := 0.25 * math.Sin(2*math.Pi*440*(float64(i)/SampleRate+0.5))
+		if d := math.Abs(float64(samples[i]) - want); d > 0.01 {
+			t.Fatalf("sample %d = %f, want %f", i, samples[i], want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Filter is one audio preprocessing step with its parameters, such as
+// highpass with f=80. Filters run in order on the decoded audio.
+type Filter struct {
+	Name string
+	Args map[string]float64
+}
+
+// filterSpec describes a filter step. A step runs in Go when newGo is set,
+// and in ffmpeg, while decoding, when it must come before an ffmpeg-only
+// step.
+type filterSpec struct {
+	params   []string // parameter names; the first may be given positionally
+	defaults []float64
+	ffmpeg   func(args map[string]float64) string // nil if Go-only
+	newGo    func(args map[string]float64) sampleFilter
+	// whole is set for Go steps that need all of the audio at once.
+	whole bool
+}
+
+var filterSpecs = map[string]filterSpec{
+	"gain": {
+		params:   []string{"db"},
+		defaults: []float64{0},
+		ffmpeg:   func(a map[string]float64) string { return fmt.Sprintf("volume=%gdB", a["db"]) },
+		newGo:    func(a map[string]float64) sampleFilter { return gain(math.Pow(10, a["db"]/20)) },
+	},
+	"normalize": {
+		params:   []string{"peak"},
+		defaults: []float64{-1},
+		newGo:    func(a map[string]float64) sampleFilter { return normalize(math.Pow(10, a["peak"]/20)) },
+		whole:    true,
+	},
+	"highpass": {
+		params:   []string{"f"},
+		defaults: []float64{80},
+		ffmpeg:   func(a map[string]float64) string { return fmt.Sprintf("highpass=f=%g", a["f"]) },
+		newGo:    func(a map[string]float64) sampleFilter { return newBiquad(a["f"], true) },
+	},
+	"lowpass": {
+		params:   []string{"f"},
+		defaults: []float64{7000},
+		ffmpeg:   func(a map[string]float64) string { return fmt.Sprintf("lowpass=f=%g", a["f"]) },
+		newGo:    func(a map[string]float64) sampleFilter { return newBiquad(a["f"], false) },
+	},
+	"loudnorm": {
+		params:   []string{"i", "tp", "lra"},
+		defaults: []float64{-16, -1.5, 11},
+		ffmpeg: func(a map[string]float64) string {
+			return fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", a["i"], a["tp"], a["lra"])
+		},
+	},
+	"afftdn": {
+		params:   []string{"nr", "nf"},
+		defaults: []float64{12, -50},
+		ffmpeg:   func(a map[string]float64) string { return fmt.Sprintf("afftdn=nr=%g:nf=%g", a["nr"], a["nf"]) },
+	},
+}
+
+// FilterNames lists the supported filter steps.
+func FilterNames() []string {
+	names := make([]string, 0, len(filterSpecs))
+	for name := range filterSpecs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ParseFilters parses a filter chain in ffmpeg's syntax: steps separated by
+// commas, each a name optionally followed by "=" and colon-separated
+// key=value parameters, e.g. "highpass=f=80,afftdn,gain=6". The first
+// parameter may be given without its key. Omitted parameters take defaults.
+func ParseFilters(chain string) ([]Filter, error) {
+	var filters []Filter
+	for _, step := range strings.Split(chain, ",") {
+		step = strings.TrimSpace(step)
+		if step == "" {
+			continue
+		}
+		name, params, _ := strings.Cut(step, "=")
+		spec, ok := filterSpecs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown audio filter %q (supported: %s)", name, strings.Join(FilterNames(), ", "))
+		}
+		f := Filter{Name: name, Args: make(map[string]float64, len(spec.params))}
+		for i, p := range spec.params {
+			f.Args[p] = spec.defaults[i]
+		}
+		if params != "" {
+			for i, param := range strings.Split(params, ":") {
+				key, value, ok := strings.Cut(param, "=")
+				if !ok && i == 0 {
+					key, value = spec.params[0], param
+				}
+				key = strings.ToLower(key)
+				if !slices.Contains(spec.params, key) {
+					return nil, fmt.Errorf("audio filter %s: unknown parameter %q", name, key)
+				}
+				v, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(value), "db"), 64)
+				if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+					return nil, fmt.Errorf("audio filter %s: invalid %s %q", name, key, value)
+				}
+				f.Args[key] = v
+			}
+		}
+		if freq, ok := f.Args["f"]; ok && (freq <= 0 || freq >= SampleRate/2) {
+			return nil, fmt.Errorf("audio filter %s: f must be between 0 and %d Hz", name, SampleRate/2)
+		}
+		filters = append(filters, f)
+	}
+	if _, _, err := splitFilters(filters); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+// splitFilters divides a chain into the steps ffmpeg runs while decoding,
+// as an -af argument, and the Go steps after them. Steps up to the last
+// ffmpeg-only one go to ffmpeg so that the order is kept, which fails for a
+// Go-only step in that stretch.
+func splitFilters(filters []Filter) (ffmpegChain string, goSteps []Filter, err error) {
+	last := -1
+	for i, f := range filters {
+		if filterSpecs[f.Name].newGo == nil {
+			last = i
+		}
+	}
+	var steps []string
+	for _, f := range filters[:last+1] {
+		spec := filterSpecs[f.Name]
+		if spec.ffmpeg == nil {
+			return "", nil, fmt.Errorf("audio filter %s must come after %s", f.Name, filters[last].Name)
+		}
+		steps = append(steps, spec.ffmpeg(f.Args))
+	}
+	return strings.Join(steps, ","), filters[last+1:], nil
+}
+
+// StreamFilters reports an error if the Go steps of filters cannot run on a
+// Stream because they need all of the audio at once.
+func StreamFilters(filters []Filter) error {
+	_, goSteps, err := splitFilters(filters)
+	if err != nil {
+		return err
+	}
+	for _, f := range goSteps {
+		if filterSpecs[f.Name].whole {
+			return fmt.Errorf("audio filter %s needs the whole audio and cannot be streamed", f.Name)
+		}
+	}
+	return nil
+}
+
+// sampleFilter processes 16kHz samples in place, keeping state across calls.
+type sampleFilter interface {
+	apply(samples []float32)
+}
+
+// newFilterChain returns fresh instances of the Go steps.
+func newFilterChain(goSteps []Filter) []sampleFilter {
+	chain := make([]sampleFilter, len(goSteps))
+	for i, f := range goSteps {
+		chain[i] = filterSpecs[f.Name].newGo(f.Args)
+	}
+	return chain
+}
+
+func applyFilters(chain []sampleFilter, samples []float32) {
+	for _, f := range chain {
+		f.apply(samples)
+	}
+}
+
+// gain scales samples by a linear factor.
+type gain float64
+
+func (g gain) apply(samples []float32) {
+	for i := range samples {
+		samples[i] *= float32(g)
+	}
+}
+
+// normalize scales samples so that the peak reaches a linear level.
+type normalize float64
+
+func (n normalize) apply(samples []float32) {
+	var peak float32
+	for _, v := range samples {
+		peak = max(peak, v, -v)
+	}
+	if peak > 0 {
+		gain(float64(n) / float64(peak)).apply(samples)
+	}
+}
+
+// biquad is a second-order Butterworth high- or low-pass filter (RBJ audio
+// EQ cookbook) at SampleRate.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func newBiquad(freq float64, highpass bool) *biquad {
+	w := 2 * math.Pi * freq / SampleRate
+	alpha := math.Sin(w) / math.Sqrt2 // Q = 1/sqrt(2)
+	cos := math.Cos(w)
+	a0 := 1 + alpha
+	f := &biquad{a1: -2 * cos / a0, a2: (1 - alpha) / a0}
+	if highpass {
+		f.b0 = (1 + cos) / 2 / a0
+		f.b1 = -(1 + cos) / a0
+	} else {
+		f.b0 = (1 - cos) / 2 / a0
+		f.b1 = (1 - cos) / a0
+	}
+	f.b2 = f.b0
+	return f
+}
+
+func (f *biquad) apply(samples []float32) {
+	for i, v := range samples {
+		x := float64(v)
+		y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+		f.x2, f.x1 = f.x1, x
+		f.y2, f.y1 = f.y1, y
+		samples[i] = float32(y)
+	}
+}
@@ -0,0 +1,100 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFilters(t *testing.T) {
+	filters, err := ParseFilters("highpass=f=120, gain=6dB,loudnorm=I=-20:lra=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 3 || filters[0].Args["f"] != 120 || filters[1].Args["db"] != 6 {
+		t.Fatalf("got %+v", filters)
+	}
+	if got := filters[2].Args; got["i"] != -20 || got["lra"] != 7 || got["tp"] != -1.5 {
+		t.Errorf("loudnorm args = %v, want defaults for the rest", got)
+	}
+
+	for _, bad := range []string{"reverb", "gain=loud", "gain=x=1", "highpass=9000", "normalize,afftdn",
+		"highpass=f=nan", "lowpass=NaN", "gain=inf", "gain=-Inf", "loudnorm=i=+inf"} {
+		if _, err := ParseFilters(bad); err == nil {
+			t.Errorf("ParseFilters(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestSplitFilters(t *testing.T) {
+	filters, err := ParseFilters("highpass,afftdn,gain=3,normalize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, goSteps, _ := splitFilters(filters)
+	if chain != "highpass=f=80,afftdn=nr=12:nf=-50" {
+		t.Errorf("ffmpeg chain = %q", chain)
+	}
+	if len(goSteps) != 2 || goSteps[0].Name != "gain" || goSteps[1].Name != "normalize" {
+		t.Errorf("Go steps = %+v", goSteps)
+	}
+	if args := ffmpegDecodeArgs("in", ReadOptions{Filters: filters}, true); !slices.Contains(args, chain) {
+		t.Errorf("ffmpeg args %v lack the filter chain", args)
+	}
+	if err := StreamFilters(filters); err == nil || !strings.Contains(err.Error(), "normalize") {
+		t.Errorf("StreamFilters() = %v, want normalize rejected", err)
+	}
+}
+
+// rms returns the root mean square of samples.
+func rms(samples []float32) float64 {
+	var sum float64
+	for _, v := range samples {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestBiquad(t *testing.T) {
+	for _, tt := range []struct {
+		highpass  bool
+		freq      float64
+		pass, cut float64
+	}{
+		{true, 1000, 4000, 100},
+		{false, 1000, 100, 4000},
+	} {
+		pass, cut := sine(SampleRate, SampleRate, tt.pass), sine(SampleRate, SampleRate, tt.cut)
+		newBiquad(tt.freq, tt.highpass).apply(pass)
+		newBiquad(tt.freq, tt.highpass).apply(cut)
+		// Skip the filter's settling time.
+		if got := rms(pass[SampleRate/10:]); math.Abs(got-0.5/math.Sqrt2) > 0.01 {
+			t.Errorf("highpass=%v: %v Hz RMS = %f, want unchanged", tt.highpass, tt.pass, got)
+		}
+		if got := rms(cut[SampleRate/10:]); got > 0.03 { // 12 dB per octave
+			t.Errorf("highpass=%v: %v Hz RMS = %f, want attenuated", tt.highpass, tt.cut, got)
+		}
+	}
+}
+
+func TestReadWithFilters(t *testing.T) {
+	tone := sine(SampleRate, SampleRate, 440)
+	filters, err := ParseFilters("gain=-6,normalize=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := ReadWithOptions(context.Background(), bytes.NewReader(stereoWAV(SampleRate, tone, tone)), ReadOptions{Filters: filters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var peak float32
+	for _, v := range samples {
+		peak = max(peak, v, -v)
+	}
+	if math.Abs(float64(peak)-1) > 1e-4 {
+		t.Errorf("peak = %f, want 1 after normalize", peak)
+	}
+}
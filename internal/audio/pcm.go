@@ -0,0 +1,126 @@
+package audio
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"strconv"
+
+	"github.com/thewh1teagle/sona/internal/wav"
+)
+
+// Raw PCM encodings.
+const (
+	PCMS16BE = "s16be" // audio/L16 (RFC 2586), network byte order
+	PCMF32LE = "f32le" // audio/f32le
+)
+
+// PCMFormat describes headerless PCM samples.
+type PCMFormat struct {
+	Encoding string // PCMS16BE or PCMF32LE
+	Rate     int
+	Channels int
+}
+
+// ParsePCMType parses a raw PCM media type, "audio/L16" or "audio/f32le",
+// with optional rate and channels parameters that default to 16000 and 1.
+// It returns nil for any other media type.
+func ParsePCMType(contentType string) (*PCMFormat, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil
+	}
+	f := PCMFormat{Rate: SampleRate, Channels: 1}
+	switch mediaType {
+	case "audio/l16":
+		f.Encoding = PCMS16BE
+	case "audio/f32le":
+		f.Encoding = PCMF32LE
+	default:
+		return nil, nil
+	}
+	if v, ok := params["rate"]; ok {
+		if f.Rate, err = strconv.Atoi(v); err != nil || f.Rate <= 0 {
+			return nil, fmt.Errorf("%s: invalid rate %q", mediaType, v)
+		}
+		if f.Rate > wav.MaxSampleRate {
+			return nil, fmt.Errorf("%s: sample rate %d (at most %d)", mediaType, f.Rate, wav.MaxSampleRate)
+		}
+	}
+	if v, ok := params["channels"]; ok {
+		if f.Channels, err = strconv.Atoi(v); err != nil || f.Channels <= 0 || f.Channels > 64 {
+			return nil, fmt.Errorf("%s: invalid channels %q", mediaType, v)
+		}
+	}
+	return &f, nil
+}
+
+// ReadPCM decodes raw PCM from r into 16kHz mono samples without ffmpeg or a
+// container, applying opts like ReadWithOptions. Filters that need ffmpeg
+// and AudioTrack are not supported.
+func ReadPCM(ctx context.Context, r io.Reader, f PCMFormat, opts ReadOptions) ([]float32, error) {
+	ffmpegChain, goSteps, err := splitFilters(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+	if ffmpegChain != "" {
+		return nil, fmt.Errorf("audio filters %q need ffmpeg, which raw PCM is not decoded with", ffmpegChain)
+	}
+	if opts.AudioTrack > 0 {
+		return nil, errors.New("raw PCM has a single audio stream")
+	}
+	samples, err := readAll(newBlockStream(ctx, newPCMDecoder(r, f), opts))
+	if err != nil {
+		return nil, err
+	}
+	applyFilters(newFilterChain(goSteps), samples)
+	return samples, nil
+}
+
+// pcmDecoder decodes raw PCM in PCMFormat.
+type pcmDecoder struct {
+	r     io.Reader
+	f     PCMFormat
+	width int // bytes per sample
+	raw   []byte
+	block []float32
+}
+
+func newPCMDecoder(r io.Reader, f PCMFormat) *pcmDecoder {
+	width := 2
+	if f.Encoding == PCMF32LE {
+		width = 4
+	}
+	return &pcmDecoder{r: r, f: f, width: width, raw: make([]byte, 4096*f.Channels*width)}
+}
+
+func (d *pcmDecoder) rate() int     { return d.f.Rate }
+func (d *pcmDecoder) channels() int { return d.f.Channels }
+
+func (d *pcmDecoder) next() ([]float32, error) {
+	frameSize := d.f.Channels * d.width
+	nb, err := io.ReadFull(d.r, d.raw)
+	if nb < frameSize {
+		if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	nb -= nb % frameSize // a trailing partial frame is dropped
+	d.block = d.block[:0]
+	for i := 0; i < nb; i += d.width {
+		if d.width == 4 {
+			d.block = append(d.block, math.Float32frombits(binary.LittleEndian.Uint32(d.raw[i:])))
+		} else {
+			d.block = append(d.block, float32(int16(binary.BigEndian.Uint16(d.raw[i:])))/math.MaxInt16)
+		}
+	}
+	return d.block, nil
+}
@@ -0,0 +1,68 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestParsePCMType(t *testing.T) {
+	for _, tt := range []struct {
+		contentType string
+		want        *PCMFormat
+	}{
+		{"audio/L16;rate=8000;channels=2", &PCMFormat{PCMS16BE, 8000, 2}},
+		{"audio/f32le", &PCMFormat{PCMF32LE, SampleRate, 1}},
+		{"audio/mpeg", nil},
+		{"application/octet-stream", nil},
+		{"", nil},
+	} {
+		got, err := ParsePCMType(tt.contentType)
+		if err != nil {
+			t.Errorf("ParsePCMType(%q): %v", tt.contentType, err)
+		} else if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("ParsePCMType(%q) = %+v, want %+v", tt.contentType, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"audio/L16;rate=0", "audio/L16;rate=768001", "audio/f32le;channels=x"} {
+		if _, err := ParsePCMType(bad); err == nil {
+			t.Errorf("ParsePCMType(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestReadPCM(t *testing.T) {
+	// One second of 16kHz s16be with a trailing partial sample.
+	var l16 bytes.Buffer
+	for i := range SampleRate {
+		binary.Write(&l16, binary.BigEndian, int16(i%100*100))
+	}
+	l16.WriteByte(0)
+	samples, err := ReadPCM(context.Background(), &l16, PCMFormat{PCMS16BE, SampleRate, 1}, ReadOptions{Offset: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != SampleRate/2 || samples[1] != float32(100)/math.MaxInt16 {
+		t.Errorf("got %d samples starting %v, want %d from the offset", len(samples), samples[:2], SampleRate/2)
+	}
+
+	// Stereo 8kHz f32le is downmixed and resampled.
+	var f32 bytes.Buffer
+	for range 8000 {
+		binary.Write(&f32, binary.LittleEndian, []float32{0.5, -0.5})
+	}
+	samples, err = ReadPCM(context.Background(), &f32, PCMFormat{PCMF32LE, 8000, 2}, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != SampleRate || rms(samples) > 1e-3 {
+		t.Errorf("got %d samples with rms %g, want %d silent ones", len(samples), rms(samples), SampleRate)
+	}
+
+	filters, _ := ParseFilters("afftdn")
+	if _, err := ReadPCM(context.Background(), &f32, PCMFormat{PCMF32LE, 8000, 2}, ReadOptions{Filters: filters}); err == nil {
+		t.Error("ffmpeg filter on raw PCM succeeded, want error")
+	}
+}
@@ -0,0 +1,142 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// ProbeResult describes a media file and its audio streams.
+type ProbeResult struct {
+	Container string        `json:"container"`
+	Duration  float64       `json:"duration"` // seconds, 0 if unknown
+	Streams   []AudioStream `json:"streams"`
+}
+
+// AudioStream describes one audio stream. Index is its position among the
+// audio streams, as in ffmpeg's -map 0:a:Index; ReadOptions.AudioTrack is
+// Index+1.
+type AudioStream struct {
+	Index      int     `json:"index"`
+	Codec      string  `json:"codec"`
+	Channels   int     `json:"channels"`
+	SampleRate int     `json:"sample_rate"`
+	Language   string  `json:"language,omitempty"`
+	Title      string  `json:"title,omitempty"`
+	Default    bool    `json:"default"`
+	Duration   float64 `json:"duration,omitempty"` // seconds, if the container says
+}
+
+// findFFprobe looks for ffprobe in $PATH, then next to ffmpeg (which covers
+// SONA_FFMPEG_PATH and a bundled ffmpeg).
+func findFFprobe() (string, error) {
+	path, err := exec.LookPath("ffprobe")
+	if err == nil {
+		return path, nil
+	}
+	if ffmpegPath, ffErr := findFFmpeg(); ffErr == nil {
+		for _, name := range []string{"ffprobe", "ffprobe.exe"} {
+			candidate := filepath.Join(filepath.Dir(ffmpegPath), name)
+			if _, statErr := os.Stat(candidate); statErr == nil {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("ffprobe not found: %w", err)
+}
+
+// Probe runs ffprobe on r and lists its container, duration and audio
+// streams. ffprobe is killed if ctx is done.
+func Probe(ctx context.Context, r io.ReadSeeker) (ProbeResult, error) {
+	ffprobePath, err := findFFprobe()
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	input, stdin, cleanup, err := ffmpegInput(r)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-select_streams", "a",
+		input,
+	)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = ffmpegStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		return ProbeResult{}, ffmpegError(ctx, "ffprobe failed", err, stderr.String())
+	}
+	return parseProbe(stdout.Bytes())
+}
+
+// ProbeFile opens a media file by path and probes it.
+func ProbeFile(ctx context.Context, path string) (ProbeResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	defer f.Close()
+	return Probe(ctx, f)
+}
+
+// parseProbe converts ffprobe's JSON output, in which numbers are mostly
+// strings.
+func parseProbe(out []byte) (ProbeResult, error) {
+	var raw struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecName   string            `json:"codec_name"`
+			Channels    int               `json:"channels"`
+			SampleRate  string            `json:"sample_rate"`
+			Duration    string            `json:"duration"`
+			Tags        map[string]string `json:"tags"`
+			Disposition map[string]int    `json:"disposition"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return ProbeResult{}, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+	result := ProbeResult{
+		Container: raw.Format.FormatName,
+		Duration:  parseNumber(raw.Format.Duration),
+		Streams:   make([]AudioStream, len(raw.Streams)),
+	}
+	for i, st := range raw.Streams {
+		result.Streams[i] = AudioStream{
+			Index:      i,
+			Codec:      st.CodecName,
+			Channels:   st.Channels,
+			SampleRate: int(parseNumber(st.SampleRate)),
+			Language:   st.Tags["language"],
+			Title:      st.Tags["title"],
+			Default:    st.Disposition["default"] == 1,
+			Duration:   parseNumber(st.Duration),
+		}
+	}
+	return result, nil
+}
+
+// parseNumber parses an ffprobe number, which is "N/A" or empty if unknown.
+func parseNumber(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
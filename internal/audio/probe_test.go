@@ -0,0 +1,43 @@
+package audio
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseProbe(t *testing.T) {
+	out := []byte(`{
+		"streams": [
+			{"index": 1, "codec_name": "aac", "codec_type": "audio", "sample_rate": "48000", "channels": 2,
+			 "duration": "N/A", "tags": {"language": "eng"}, "disposition": {"default": 1}},
+			{"index": 2, "codec_name": "opus", "codec_type": "audio", "sample_rate": "48000", "channels": 6,
+			 "tags": {"language": "heb", "title": "Commentary"}, "disposition": {"default": 0}}
+		],
+		"format": {"format_name": "matroska,webm", "duration": "62.500000"}
+	}`)
+	got, err := parseProbe(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ProbeResult{
+		Container: "matroska,webm",
+		Duration:  62.5,
+		Streams: []AudioStream{
+			{Index: 0, Codec: "aac", Channels: 2, SampleRate: 48000, Language: "eng", Default: true},
+			{Index: 1, Codec: "opus", Channels: 6, SampleRate: 48000, Language: "heb", Title: "Commentary"},
+		},
+	}
+	if got.Container != want.Container || got.Duration != want.Duration || !slices.Equal(got.Streams, want.Streams) {
+		t.Errorf("parseProbe() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFFmpegArgsAudioTrack(t *testing.T) {
+	args := ffmpegDecodeArgs("in.mkv", ReadOptions{AudioTrack: 2}, true)
+	if i := slices.Index(args, "-map"); i < 0 || args[i+1] != "0:a:1" || i < slices.Index(args, "-i") {
+		t.Errorf("args = %v, want -map 0:a:1 after the input", args)
+	}
+	if slices.Contains(ffmpegDecodeArgs("in.mkv", ReadOptions{}, true), "-map") {
+		t.Error("-map passed without AudioTrack")
+	}
+}
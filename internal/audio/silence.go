@@ -0,0 +1,184 @@
+package audio
+
+import "math"
+
+const (
+	// silenceWindow is the 10ms window the VAD classifies.
+	silenceWindow = vadFrame
+	// minSilence is the shortest pause that is shortened (0.7s).
+	minSilence = SampleRate * 7 / 10
+	// silenceMargin is kept at each edge of a removed pause so word onsets
+	// and tails are not clipped.
+	silenceMargin = SampleRate / 10
+)
+
+// Cut records a stretch of silence dropped by RemoveSilence: Removed samples
+// were taken out at sample At of the trimmed audio.
+type Cut struct {
+	At      int64
+	Removed int64
+}
+
+// TimeMap maps times in silence-trimmed audio back to the original audio.
+type TimeMap []Cut
+
+// Original returns the time in the original audio of t seconds into the
+// trimmed audio. A time exactly at a cut is taken as the start of what
+// follows, after the removed pause; use OriginalEnd for end times.
+func (m TimeMap) Original(t float64) float64 {
+	return m.original(t, false)
+}
+
+// OriginalEnd is Original for the end of a segment or word: a time exactly
+// at a cut ends what came before, so the removed pause is not added.
+func (m TimeMap) OriginalEnd(t float64) float64 {
+	return m.original(t, true)
+}
+
+func (m TimeMap) original(t float64, end bool) float64 {
+	pos := int64(math.Round(t * SampleRate))
+	var removed int64
+	for _, c := range m {
+		if c.At > pos || end && c.At == pos {
+			break
+		}
+		removed += c.Removed
+	}
+	return t + float64(removed)/SampleRate
+}
+
+// RemoveSilence shortens every pause in speech longer than 0.7s to 0.2s,
+// which stops whisper from hallucinating over long silences. Pauses are found
+// with the same detector as DetectSpeech. The returned TimeMap maps
+// timestamps in the result back to the input.
+func RemoveSilence(samples []float32) ([]float32, TimeMap) {
+	r := newSilenceRemover(1)
+	out := r.process([][]float32{nil}, [][]float32{samples})
+	out = r.flush(out)
+	return out[0], r.cuts
+}
+
+// RemoveSilenceChannels is RemoveSilence for separately decoded channels
+// (see ReadChannels). A pause is removed only where every channel is silent,
+// so the channels keep a shared timeline and TimeMap.
+func RemoveSilenceChannels(channels [][]float32) ([][]float32, TimeMap) {
+	if len(channels) == 0 {
+		return channels, nil
+	}
+	r := newSilenceRemover(len(channels))
+	out := r.process(make([][]float32, len(channels)), channels)
+	out = r.flush(out)
+	return out, r.cuts
+}
+
+// silenceRemover removes long pauses incrementally, so it also works on a
+// Stream. It buffers at most a pause's first 0.7s.
+type silenceRemover struct {
+	pending [][]float32 // input not yet forming a whole window
+	run     [][]float32 // the current pause while it is shorter than minSilence
+	cutting bool        // the current pause is long enough to remove
+	dropped int64       // samples dropped from the current pause
+	out     int64       // samples output so far
+	cuts    TimeMap
+	vad     []*speechDetector // one per channel
+}
+
+func newSilenceRemover(channels int) *silenceRemover {
+	r := &silenceRemover{
+		pending: make([][]float32, channels),
+		run:     make([][]float32, channels),
+		vad:     make([]*speechDetector, channels),
+	}
+	for ch := range r.vad {
+		r.vad[ch] = newSpeechDetector()
+	}
+	return r
+}
+
+// process appends the filtered form of in (one slice per channel, all the
+// same length) to dst.
+func (r *silenceRemover) process(dst, in [][]float32) [][]float32 {
+	for ch := range in {
+		r.pending[ch] = append(r.pending[ch], in[ch]...)
+	}
+	n := len(r.pending[0]) / silenceWindow * silenceWindow
+	for i := 0; i < n; i += silenceWindow {
+		dst = r.window(dst, i, i+silenceWindow)
+	}
+	for ch := range r.pending {
+		r.pending[ch] = append(r.pending[ch][:0], r.pending[ch][n:]...)
+	}
+	return dst
+}
+
+// flush handles the last partial window and any trailing pause.
+func (r *silenceRemover) flush(dst [][]float32) [][]float32 {
+	if n := len(r.pending[0]); n > 0 {
+		dst = r.window(dst, 0, n)
+		for ch := range r.pending {
+			r.pending[ch] = r.pending[ch][:0]
+		}
+	}
+	return r.endRun(dst)
+}
+
+// window classifies pending[i:j] and passes it through, holds it as part of
+// a pause, or drops it.
+func (r *silenceRemover) window(dst [][]float32, i, j int) [][]float32 {
+	if !r.silent(i, j) {
+		dst = r.endRun(dst)
+		for ch := range dst {
+			dst[ch] = append(dst[ch], r.pending[ch][i:j]...)
+		}
+		r.out += int64(j - i)
+		return dst
+	}
+	for ch := range r.run {
+		r.run[ch] = append(r.run[ch], r.pending[ch][i:j]...)
+	}
+	if !r.cutting && len(r.run[0]) >= minSilence {
+		// Long enough: keep the head and from now on only the tail.
+		r.cutting = true
+		for ch := range dst {
+			dst[ch] = append(dst[ch], r.run[ch][:silenceMargin]...)
+			r.run[ch] = r.run[ch][silenceMargin:]
+		}
+		r.out += silenceMargin
+	}
+	if r.cutting {
+		if excess := len(r.run[0]) - silenceMargin; excess > 0 {
+			for ch := range r.run {
+				r.run[ch] = append(r.run[ch][:0], r.run[ch][excess:]...)
+			}
+			r.dropped += int64(excess)
+		}
+	}
+	return dst
+}
+
+// endRun outputs what is left of the current pause, recording a cut if part
+// of it was dropped.
+func (r *silenceRemover) endRun(dst [][]float32) [][]float32 {
+	if r.cutting {
+		r.cuts = append(r.cuts, Cut{At: r.out, Removed: r.dropped})
+		r.cutting, r.dropped = false, 0
+	}
+	r.out += int64(len(r.run[0]))
+	for ch := range dst {
+		dst[ch] = append(dst[ch], r.run[ch]...)
+		r.run[ch] = r.run[ch][:0]
+	}
+	return dst
+}
+
+// silent reports whether pending[i:j] has no speech on any channel. Every
+// channel's detector sees every window so that it tracks its noise floor.
+func (r *silenceRemover) silent(i, j int) bool {
+	silent := true
+	for ch, p := range r.pending {
+		if r.vad[ch].frame(p[i:j]) {
+			silent = false
+		}
+	}
+	return silent
+}
@@ -0,0 +1,95 @@
+package audio
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// speechAndPauses returns 1s of tone, 2s of silence and 1s of tone.
+func speechAndPauses() []float32 {
+	tone := sine(SampleRate, SampleRate, 440)
+	samples := append([]float32(nil), tone...)
+	samples = append(samples, make([]float32, 2*SampleRate)...)
+	return append(samples, tone...)
+}
+
+func TestRemoveSilence(t *testing.T) {
+	out, tm := RemoveSilence(speechAndPauses())
+	// The pause keeps 0.1s at each edge.
+	if want := 2*SampleRate + 2*silenceMargin; len(out) != want {
+		t.Fatalf("got %d samples, want %d", len(out), want)
+	}
+	if len(tm) != 1 || tm[0].Removed != 2*SampleRate-2*silenceMargin {
+		t.Fatalf("cuts = %+v", tm)
+	}
+	for _, tt := range []struct{ trimmed, want float64 }{
+		{0.5, 0.5},
+		{1.05, 1.05}, // in the kept head of the pause
+		{1.2, 3.0},   // second tone starts
+		{2.0, 3.8},
+	} {
+		if got := tm.Original(tt.trimmed); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Original(%v) = %v, want %v", tt.trimmed, got, tt.want)
+		}
+	}
+	// A segment ending exactly at the cut ends before the removed pause.
+	at := float64(tm[0].At) / SampleRate
+	if got := tm.OriginalEnd(at); math.Abs(got-at) > 1e-9 {
+		t.Errorf("OriginalEnd(%v) = %v, want %v", at, got, at)
+	}
+	if got, want := tm.OriginalEnd(2.0), 3.8; math.Abs(got-want) > 1e-9 {
+		t.Errorf("OriginalEnd(2.0) = %v, want %v", got, want)
+	}
+
+	// Short pauses are kept.
+	short := append(sine(SampleRate, SampleRate, 440), make([]float32, SampleRate/2)...)
+	short = append(short, sine(SampleRate, SampleRate, 440)...)
+	if out, tm := RemoveSilence(short); len(out) != len(short) || len(tm) != 0 {
+		t.Errorf("0.5s pause: got %d samples, cuts %v", len(out), tm)
+	}
+}
+
+func TestRemoveSilenceChannels(t *testing.T) {
+	// The right channel talks during the left channel's pause.
+	left := speechAndPauses()
+	right := make([]float32, len(left))
+	copy(right[SampleRate:], sine(SampleRate, SampleRate, 440))
+	out, tm := RemoveSilenceChannels([][]float32{left, right})
+	if len(out) != 2 || len(out[0]) != len(out[1]) {
+		t.Fatalf("got %d channels", len(out))
+	}
+	// Only the second second of the pause is silent on both.
+	if want := 3*SampleRate + 2*silenceMargin; len(out[0]) != want || len(tm) != 1 {
+		t.Errorf("got %d samples, cuts %v, want %d samples", len(out[0]), tm, want)
+	}
+}
+
+func TestStreamRemoveSilence(t *testing.T) {
+	samples := speechAndPauses()
+	path := filepath.Join(t.TempDir(), "pauses.wav")
+	if err := os.WriteFile(path, stereoWAV(SampleRate, samples, samples), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenStream(context.Background(), path, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.RemoveSilence()
+	var got []float32
+	buf := make([]float32, 1000) // not a multiple of the window
+	for {
+		n, err := s.Read(buf)
+		got = append(got, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+	want, wantMap := RemoveSilence(samples)
+	if len(got) != len(want) || len(s.TimeMap()) != len(wantMap) || s.TimeMap()[0] != wantMap[0] {
+		t.Errorf("stream: %d samples, cuts %v; want %d, %v", len(got), s.TimeMap(), len(want), wantMap)
+	}
+}
@@ -0,0 +1,428 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+
+	"github.com/thewh1teagle/sona/internal/resample"
+	"github.com/thewh1teagle/sona/internal/wav"
+)
+
+// Stream decodes an audio file incrementally into 16kHz mono samples, so
+// arbitrarily long inputs can be processed with bounded memory.
+type Stream struct {
+	ctx       context.Context // stops decoding (and kills ffmpeg) when done
+	r         *bufio.Reader
+	raw       []byte // read buffer
+	float     bool   // f32le samples (ffmpeg) rather than s16le (native WAV)
+	remaining int64  // samples left to read, -1 = until EOF
+	total     int64  // total samples, 0 if unknown
+	file      *os.File
+	cmd       *exec.Cmd
+	stderr    bytes.Buffer
+	done      bool
+
+	// Go decoding (see decode.go) instead of r.
+	dec     blockDecoder
+	rs      *resample.Resampler
+	mono    []float32 // downmix buffer
+	out     []float32 // resampled output buffer
+	pending []float32 // unread part of out
+	skip    int64     // samples still to drop for ReadOptions.Offset
+	decEOF  bool
+
+	filters []sampleFilter // Go steps of ReadOptions.Filters
+
+	// Silence removal (see RemoveSilence) applied to the output.
+	silence  *silenceRemover
+	filtered [][]float32 // filter output buffer
+	unread   []float32   // unread part of filtered[0]
+	srcEOF   bool
+}
+
+// OpenStream starts decoding path. WAVs and the formats in decode.go are
+// decoded in Go; anything else, or a filter chain with ffmpeg steps, is piped
+// through ffmpeg as raw f32le. Reads fail with ctx's error once ctx is done.
+// The caller must Close the stream.
+func OpenStream(ctx context.Context, path string, opts ReadOptions) (*Stream, error) {
+	if err := StreamFilters(opts.Filters); err != nil {
+		return nil, err
+	}
+	ffmpegChain, goSteps, _ := splitFilters(opts.Filters)
+	s, err := openStream(ctx, path, opts, ffmpegChain != "" || opts.AudioTrack > 0)
+	if err != nil {
+		return nil, err
+	}
+	s.filters = newFilterChain(goSteps)
+	return s, nil
+}
+
+func openStream(ctx context.Context, path string, opts ReadOptions, useFFmpeg bool) (*Stream, error) {
+	if useFFmpeg {
+		return newFFmpegStream(ctx, path, nil, opts)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if h, err := wav.ReadHeader(f); err == nil && h.Supported() == nil {
+		s, err := openWavStream(ctx, f, opts)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		s.file = f
+		return s, nil
+	}
+	f.Seek(0, io.SeekStart)
+	if s := newDecoderStream(ctx, f, opts); s != nil {
+		s.file = f
+		return s, nil
+	}
+	f.Close()
+	return newFFmpegStream(ctx, path, nil, opts)
+}
+
+// newDecoderStream decodes r in Go when its format is recognized (see
+// sniffFormat). It returns nil when r needs ffmpeg: an unknown format or a
+// decoder that rejects the header. r is rewound in that case.
+func newDecoderStream(ctx context.Context, r io.ReadSeeker, opts ReadOptions) *Stream {
+	dec, err := newBlockDecoder(bufio.NewReaderSize(r, 1<<16))
+	if dec == nil || err != nil {
+		if err != nil && verbose {
+			fmt.Fprintf(os.Stderr, "warning: %v, falling back to ffmpeg\n", err)
+		}
+		r.Seek(0, io.SeekStart)
+		return nil
+	}
+	return newBlockStream(ctx, dec, opts)
+}
+
+// newBlockStream reads dec, downmixed and resampled, trimmed to opts.Offset
+// and opts.Duration.
+func newBlockStream(ctx context.Context, dec blockDecoder, opts ReadOptions) *Stream {
+	s := &Stream{ctx: ctx, dec: dec, rs: resample.New(dec.rate(), SampleRate), remaining: -1}
+	if opts.Offset > 0 {
+		s.skip = int64(opts.Offset * SampleRate)
+	}
+	if opts.Duration > 0 {
+		s.remaining = int64(opts.Duration * SampleRate)
+	}
+	return s
+}
+
+// newFFmpegStream starts ffmpeg decoding input to raw f32le on its stdout.
+// input is a path, or "pipe:0" with stdin as the source.
+func newFFmpegStream(ctx context.Context, input string, stdin io.Reader, opts ReadOptions) (*Stream, error) {
+	ffmpegPath, err := findFFmpeg()
+	if err != nil {
+		return nil, err
+	}
+	args := append(ffmpegDecodeArgs(input, opts, true), "-f", "f32le", "-acodec", "pcm_f32le", "-")
+	s := &Stream{ctx: ctx, float: true, remaining: -1}
+	s.cmd = exec.CommandContext(ctx, ffmpegPath, args...)
+	s.cmd.Stdin = stdin
+	s.cmd.Stderr = ffmpegStderr(&s.stderr)
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	s.r = bufio.NewReaderSize(stdout, 1<<16)
+	return s, nil
+}
+
+// openWavStream reads a supported WAV, seeking past opts.Offset. Native WAVs
+// are read as raw s16le; anything else is decoded, downmixed and resampled.
+// A WAV whose data size is unknown is read until EOF.
+func openWavStream(ctx context.Context, r io.ReadSeeker, opts ReadOptions) (*Stream, error) {
+	h, dataSize, err := wav.DataChunk(r)
+	if err != nil {
+		return nil, err
+	}
+	frameSize := int64(h.FrameSize())
+	rate := float64(h.SampleRate)
+	n := int64(-1) // frames to read, -1 = until EOF
+	skip := int64(opts.Offset * rate)
+	if dataSize != wav.UnknownSize {
+		n = dataSize / frameSize
+		skip = min(skip, n)
+		n -= skip
+	}
+	if _, err := r.Seek(skip*frameSize, io.SeekCurrent); err != nil {
+		return nil, err
+	}
+	// Total is only known when the header gives the data size.
+	known := n >= 0
+	if opts.Duration > 0 {
+		if d := int64(opts.Duration * rate); n < 0 || d < n {
+			n = d
+		}
+	}
+	br := bufio.NewReaderSize(r, 1<<16)
+	if h.IsNative() {
+		s := &Stream{ctx: ctx, r: br, remaining: n}
+		if known {
+			s.total = n
+		}
+		return s, nil
+	}
+	var src io.Reader = br
+	if n >= 0 {
+		src = io.LimitReader(br, n*frameSize)
+	}
+	s := &Stream{
+		ctx:       ctx,
+		dec:       newWavDecoder(src, h),
+		rs:        resample.New(int(h.SampleRate), SampleRate),
+		remaining: -1,
+	}
+	if known {
+		s.total = (n*SampleRate + int64(h.SampleRate) - 1) / int64(h.SampleRate)
+	}
+	return s, nil
+}
+
+// Total returns the number of samples the stream will produce, or 0 when it
+// is not known in advance (ffmpeg or compressed input, or silence removal).
+func (s *Stream) Total() int64 {
+	if s.silence != nil {
+		return 0
+	}
+	return s.total
+}
+
+// RemoveSilence makes the stream shorten long pauses like RemoveSilence.
+// TimeMap maps times in its output back to the input. Call it before the
+// first Read.
+func (s *Stream) RemoveSilence() {
+	s.silence = newSilenceRemover(1)
+	s.filtered = make([][]float32, 1)
+}
+
+// TimeMap returns the cuts made by RemoveSilence in the samples read so far.
+func (s *Stream) TimeMap() TimeMap {
+	if s.silence == nil {
+		return nil
+	}
+	return s.silence.cuts
+}
+
+// Read fills p with samples and returns how many were read. It returns
+// io.EOF after the last sample, or ffmpeg's error if decoding failed.
+func (s *Stream) Read(p []float32) (int, error) {
+	if s.silence == nil {
+		return s.readSource(p)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(s.unread) == 0 {
+		if s.srcEOF {
+			return 0, io.EOF
+		}
+		n, err := s.readSource(p)
+		s.filtered[0] = s.filtered[0][:0]
+		switch {
+		case errors.Is(err, io.EOF):
+			s.srcEOF = true
+			s.filtered = s.silence.flush(s.filtered)
+		case err != nil:
+			return 0, err
+		default:
+			s.filtered = s.silence.process(s.filtered, [][]float32{p[:n]})
+		}
+		s.unread = s.filtered[0]
+	}
+	n := copy(p, s.unread)
+	s.unread = s.unread[n:]
+	return n, nil
+}
+
+// readSource is Read before silence removal.
+func (s *Stream) readSource(p []float32) (int, error) {
+	if s.done {
+		return 0, io.EOF
+	}
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if s.remaining >= 0 && int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+	var n int
+	var err error
+	if s.dec != nil {
+		n, err = s.readDecoded(p)
+	} else {
+		n, err = s.readRaw(p)
+	}
+	if err != nil {
+		return 0, err
+	}
+	applyFilters(s.filters, p[:n])
+	if s.remaining >= 0 {
+		s.remaining -= int64(n)
+	}
+	if n < len(p) || s.remaining == 0 {
+		s.done = true
+		if err := s.wait(); err != nil {
+			return n, err
+		}
+		if n == 0 {
+			return 0, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// readRaw converts PCM from r (native WAV or ffmpeg) into p.
+func (s *Stream) readRaw(p []float32) (int, error) {
+	width := 2
+	if s.float {
+		width = 4
+	}
+	if cap(s.raw) < len(p)*width {
+		s.raw = make([]byte, len(p)*width)
+	}
+	raw := s.raw[:len(p)*width]
+	nb, err := io.ReadFull(s.r, raw)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+	n := nb / width
+	for i := range n {
+		if s.float {
+			p[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+		} else {
+			p[i] = float32(int16(binary.LittleEndian.Uint16(raw[i*2:]))) / math.MaxInt16
+		}
+	}
+	return n, nil
+}
+
+// readDecoded fills p from the Go decoder, resampling to 16kHz. It reads
+// fewer than len(p) samples only at the end of the audio.
+func (s *Stream) readDecoded(p []float32) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) == 0 {
+			if s.decEOF {
+				break
+			}
+			block, err := s.dec.next()
+			switch {
+			case errors.Is(err, io.EOF):
+				s.out = s.rs.Flush(s.out[:0])
+				s.decEOF = true
+			case err != nil:
+				return 0, err
+			default:
+				s.mono = downmix(s.mono[:0], block, s.dec.channels())
+				s.out = s.rs.Process(s.mono, s.out[:0])
+			}
+			s.pending = s.out
+			if s.skip > 0 {
+				k := min(s.skip, int64(len(s.pending)))
+				s.pending = s.pending[k:]
+				s.skip -= k
+			}
+			continue
+		}
+		c := copy(p[n:], s.pending)
+		s.pending = s.pending[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// wait reaps ffmpeg after its output is drained.
+func (s *Stream) wait() error {
+	if s.cmd == nil {
+		return nil
+	}
+	cmd := s.cmd
+	s.cmd = nil
+	if err := cmd.Wait(); err != nil {
+		return ffmpegError(s.ctx, "ffmpeg decoding failed", err, s.stderr.String())
+	}
+	return nil
+}
+
+// readAll drains s into one slice.
+func readAll(s *Stream) ([]float32, error) {
+	samples := make([]float32, 0, max(s.Total(), chunkReadSize))
+	for {
+		if len(samples) == cap(samples) {
+			samples = append(samples, 0)[:len(samples)]
+		}
+		n, err := s.Read(samples[len(samples):cap(samples)])
+		samples = samples[:len(samples)+n]
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// needsSeeking reports whether r is an MP4/MOV file whose moov atom follows
+// the media data. ffmpeg cannot demux such files from a pipe. r is rewound.
+func needsSeeking(r io.ReadSeeker) bool {
+	defer r.Seek(0, io.SeekStart)
+	var pos int64
+	for i := 0; i < 64; i++ {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return false
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		switch box := string(hdr[4:8]); {
+		case i == 0 && box != "ftyp":
+			return false
+		case box == "moov":
+			return false
+		case box == "mdat":
+			return true
+		}
+		if size == 1 { // 64-bit size follows the header
+			var ext [8]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return false
+			}
+			size = int64(binary.BigEndian.Uint64(ext[:]))
+		}
+		if size < 8 { // 0 = box runs to EOF
+			return false
+		}
+		pos += size
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// Close releases the input file or stops ffmpeg if it is still running.
+func (s *Stream) Close() error {
+	if s.file != nil {
+		s.file.Close()
+	}
+	if s.cmd != nil {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+		s.cmd = nil
+	}
+	return nil
+}
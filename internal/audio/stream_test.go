@@ -0,0 +1,42 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// mp4Boxes builds a file from top-level boxes with 8 payload bytes each.
+func mp4Boxes(types ...string) []byte {
+	var buf bytes.Buffer
+	for _, typ := range types {
+		binary.Write(&buf, binary.BigEndian, uint32(16))
+		buf.WriteString(typ)
+		buf.Write(make([]byte, 8))
+	}
+	return buf.Bytes()
+}
+
+func TestNeedsSeeking(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"trailing moov", mp4Boxes("ftyp", "free", "mdat", "moov"), true},
+		{"faststart", mp4Boxes("ftyp", "moov", "mdat"), false},
+		{"not mp4", append([]byte("RIFF\x00\x00\x00\x00WAVE"), make([]byte, 32)...), false},
+		{"truncated", mp4Boxes("ftyp")[:12], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			if got := needsSeeking(r); got != tt.want {
+				t.Errorf("needsSeeking = %v, want %v", got, tt.want)
+			}
+			if pos, _ := r.Seek(0, 1); pos != 0 {
+				t.Errorf("reader left at %d, want 0", pos)
+			}
+		})
+	}
+}
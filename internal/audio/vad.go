@@ -0,0 +1,142 @@
+package audio
+
+import "math"
+
+const (
+	// vadFrame is the 10ms frame the VAD classifies.
+	vadFrame = SampleRate / 100
+	// vadOnset and vadOffset are how many dB above the noise floor a frame
+	// must be to start speech and to keep it going (hysteresis).
+	vadOnset  = 12.0
+	vadOffset = 6.0
+	// vadMinOnset and vadMaxOnset bound the onset threshold in dBFS, so
+	// digital silence does not make hiss count as speech and a noisy floor
+	// does not hide quiet speech.
+	vadMinOnset = -50.0
+	vadMaxOnset = -30.0
+	// vadFricativeZCR is the zero-crossing rate above which a frame over
+	// the offset threshold starts speech: unvoiced consonants such as "s"
+	// and "f" are quiet but cross zero often.
+	vadFricativeZCR = 0.3
+	// vadFloorRise is how fast the noise floor creeps up, in dB per frame
+	// (2 dB/s). It drops at once to any quieter frame.
+	vadFloorRise = 0.02
+)
+
+// VADOptions tunes DetectSpeech. Zero fields take whisper.cpp's VAD
+// defaults.
+type VADOptions struct {
+	MinSpeech  float64 // seconds; shorter speech is dropped (default 0.25)
+	MinSilence float64 // seconds; shorter pauses are bridged (default 0.1)
+	Pad        float64 // seconds added before and after each region (default 0.03)
+}
+
+// SpeechSegment is a region of speech, in seconds.
+type SpeechSegment struct {
+	Start float64
+	End   float64
+}
+
+// DetectSpeech finds the speech in 16kHz mono samples with an energy and
+// zero-crossing-rate detector, for when no VAD model is available. Like
+// whisper_vad_segments_from_samples, short pauses are bridged, short bursts
+// dropped and the regions padded.
+func DetectSpeech(samples []float32, opts VADOptions) []SpeechSegment {
+	if opts.MinSpeech <= 0 {
+		opts.MinSpeech = 0.25
+	}
+	if opts.MinSilence <= 0 {
+		opts.MinSilence = 0.1
+	}
+	if opts.Pad <= 0 {
+		opts.Pad = 0.03
+	}
+
+	// Speech frames as sample ranges, bridging short pauses.
+	var regions [][2]int
+	d := newSpeechDetector()
+	minSilence := int(opts.MinSilence * SampleRate)
+	for i := 0; i < len(samples); i += vadFrame {
+		j := min(i+vadFrame, len(samples))
+		if !d.frame(samples[i:j]) {
+			continue
+		}
+		if n := len(regions); n > 0 && i-regions[n-1][1] < minSilence {
+			regions[n-1][1] = j
+		} else {
+			regions = append(regions, [2]int{i, j})
+		}
+	}
+
+	var segments []SpeechSegment
+	minSpeech := int(opts.MinSpeech * SampleRate)
+	pad := int(opts.Pad * SampleRate)
+	for _, reg := range regions {
+		if reg[1]-reg[0] < minSpeech {
+			continue
+		}
+		start, end := max(reg[0]-pad, 0), min(reg[1]+pad, len(samples))
+		if n := len(segments); n > 0 && float64(start)/SampleRate <= segments[n-1].End {
+			segments[n-1].End = float64(end) / SampleRate
+			continue
+		}
+		segments = append(segments, SpeechSegment{float64(start) / SampleRate, float64(end) / SampleRate})
+	}
+	return segments
+}
+
+// speechDetector classifies consecutive frames as speech or not, tracking
+// the noise floor as it goes.
+type speechDetector struct {
+	floor    float64 // dBFS
+	speaking bool
+}
+
+// newSpeechDetector starts with the first frame as the noise floor; if that
+// is speech, vadMaxOnset still lets it through until a pause lowers the floor.
+func newSpeechDetector() *speechDetector {
+	return &speechDetector{floor: math.Inf(1)}
+}
+
+// frame reports whether the next frame of samples is speech.
+func (d *speechDetector) frame(samples []float32) bool {
+	if len(samples) == 0 {
+		return d.speaking
+	}
+	var sum float64
+	crossings := 0
+	for i, v := range samples {
+		sum += float64(v) * float64(v)
+		if i > 0 && (v >= 0) != (samples[i-1] >= 0) {
+			crossings++
+		}
+	}
+	level := 10 * math.Log10(sum/float64(len(samples))+1e-12)
+	zcr := float64(crossings) / float64(len(samples))
+
+	d.floor = min(d.floor+vadFloorRise, level)
+	onset := min(max(d.floor+vadOnset, vadMinOnset), vadMaxOnset)
+	// Keep the offset threshold clear of the floor so noise ends speech.
+	offset := min(max(onset-(vadOnset-vadOffset), d.floor+3), onset)
+	if d.speaking {
+		d.speaking = level >= offset
+	} else {
+		d.speaking = level >= onset || (level >= offset && zcr >= vadFricativeZCR)
+	}
+	return d.speaking
+}
+
+// speechGap returns the middle of the longest pause between the speech
+// regions DetectSpeech finds in samples, or -1 if there is none.
+func speechGap(samples []float32) int {
+	best, bestLen := -1, 0
+	prev := 0
+	for _, seg := range append(DetectSpeech(samples, VADOptions{}), SpeechSegment{Start: float64(len(samples)) / SampleRate}) {
+		start := int(math.Round(seg.Start * SampleRate))
+		if start-prev > bestLen {
+			best, bestLen = (prev+start)/2, start-prev
+		}
+		prev = int(math.Round(seg.End * SampleRate))
+	}
+	return best
+}
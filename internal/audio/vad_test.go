@@ -0,0 +1,39 @@
+package audio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDetectSpeech(t *testing.T) {
+	near := func(got, want float64) bool { return math.Abs(got-want) < 0.02 }
+
+	segs := DetectSpeech(speechAndPauses(), VADOptions{})
+	if len(segs) != 2 || segs[0].Start != 0 || !near(segs[0].End, 1.03) || !near(segs[1].Start, 2.97) || segs[1].End != 4 {
+		t.Errorf("DetectSpeech() = %+v, want the two tones padded by 30ms", segs)
+	}
+
+	// A 50ms pause is bridged and a 0.1s burst dropped.
+	tone := sine(SampleRate, SampleRate/2, 440)
+	samples := append(append([]float32(nil), tone...), make([]float32, SampleRate/20)...)
+	samples = append(samples, tone...)
+	samples = append(samples, make([]float32, SampleRate)...)
+	samples = append(samples, sine(SampleRate, SampleRate/10, 440)...)
+	if segs := DetectSpeech(samples, VADOptions{}); len(segs) != 1 || !near(segs[0].End, 1.08) {
+		t.Errorf("DetectSpeech() = %+v, want one region ending after the second tone", segs)
+	}
+
+	// Steady hiss is noise, not speech, once the floor has adapted to it.
+	rng := rand.New(rand.NewSource(1))
+	hiss := make([]float32, 4*SampleRate)
+	for i := range hiss {
+		hiss[i] = float32(rng.NormFloat64() * 0.002) // about -54 dBFS
+	}
+	for i, v := range sine(SampleRate, SampleRate, 440) {
+		hiss[2*SampleRate+i] += v
+	}
+	if segs := DetectSpeech(hiss, VADOptions{}); len(segs) != 1 || !near(segs[0].Start, 1.97) || !near(segs[0].End, 3.03) {
+		t.Errorf("DetectSpeech() over hiss = %+v, want only the tone", segs)
+	}
+}
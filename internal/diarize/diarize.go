@@ -1,6 +1,7 @@
 package diarize
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -55,16 +56,20 @@ func Available() bool {
 
 // Diarize runs sona-diarize on the given audio file using the given model
 // and returns speaker segments. The audioPath must be a WAV file on disk.
-func Diarize(modelPath, audioPath string) ([]Segment, error) {
+// sona-diarize is killed if ctx is done.
+func Diarize(ctx context.Context, modelPath, audioPath string) ([]Segment, error) {
 	binPath, err := findDiarizer()
 	if err != nil {
 		return nil, err
 	}
 
-	cmd := exec.Command(binPath, modelPath, audioPath)
+	cmd := exec.CommandContext(ctx, binPath, modelPath, audioPath)
 	cmd.Stderr = os.Stderr
 
 	out, err := cmd.Output()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, fmt.Errorf("sona-diarize: %w", ctxErr)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("sona-diarize failed: %w", err)
 	}
@@ -0,0 +1,340 @@
+package ggml
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FileMagic is the "ggml" magic at the start of every whisper.cpp model file.
+const FileMagic = 0x67676d6c
+
+// qntVersionFactor separates the quantization version from the ftype field.
+const qntVersionFactor = 1000
+
+var (
+	// ErrNotWhisperModel is returned for files that are not whisper GGML models.
+	ErrNotWhisperModel = errors.New("not a whisper model")
+	// ErrTruncated is returned when the file ends before the last tensor.
+	ErrTruncated = errors.New("model file is truncated")
+)
+
+// Hparams holds the hyperparameters stored at the start of a whisper model file.
+type Hparams struct {
+	NVocab      int32
+	NAudioCtx   int32
+	NAudioState int32
+	NAudioHead  int32
+	NAudioLayer int32
+	NTextCtx    int32
+	NTextState  int32
+	NTextHead   int32
+	NTextLayer  int32
+	NMels       int32
+	FType       int32
+}
+
+// ModelInfo describes a whisper model's architecture.
+type ModelInfo struct {
+	Type         string `json:"type"` // tiny, base, small, medium, large
+	Multilingual bool   `json:"multilingual"`
+	NVocab       int    `json:"n_vocab"`
+	NAudioCtx    int    `json:"n_audio_ctx"`
+	NAudioState  int    `json:"n_audio_state"`
+	NAudioHead   int    `json:"n_audio_head"`
+	NAudioLayer  int    `json:"n_audio_layer"`
+	NTextCtx     int    `json:"n_text_ctx"`
+	NTextState   int    `json:"n_text_state"`
+	NTextHead    int    `json:"n_text_head"`
+	NTextLayer   int    `json:"n_text_layer"`
+	NMels        int    `json:"n_mels"`
+	FType        int    `json:"ftype"`
+	Quantization string `json:"quantization"` // f32, f16, q5_0, q8_0, ...
+	NTensors     int    `json:"n_tensors,omitempty"`
+}
+
+// NewModelInfo derives model info from hyperparameters the same way
+// whisper.cpp does when loading a model.
+func NewModelInfo(hp Hparams) ModelInfo {
+	ftype := int(hp.FType % qntVersionFactor)
+	return ModelInfo{
+		Type:         ModelType(int(hp.NAudioLayer)),
+		Multilingual: hp.NVocab >= 51865,
+		NVocab:       int(hp.NVocab),
+		NAudioCtx:    int(hp.NAudioCtx),
+		NAudioState:  int(hp.NAudioState),
+		NAudioHead:   int(hp.NAudioHead),
+		NAudioLayer:  int(hp.NAudioLayer),
+		NTextCtx:     int(hp.NTextCtx),
+		NTextState:   int(hp.NTextState),
+		NTextHead:    int(hp.NTextHead),
+		NTextLayer:   int(hp.NTextLayer),
+		NMels:        int(hp.NMels),
+		FType:        ftype,
+		Quantization: FTypeName(ftype),
+	}
+}
+
+// ModelType maps the encoder layer count to whisper's model size name.
+func ModelType(nAudioLayer int) string {
+	switch nAudioLayer {
+	case 4:
+		return "tiny"
+	case 6:
+		return "base"
+	case 12:
+		return "small"
+	case 24:
+		return "medium"
+	case 32:
+		return "large"
+	}
+	return "unknown"
+}
+
+// FTypeName returns the name of a ggml file type (the "ftype" hparam).
+func FTypeName(ftype int) string {
+	switch ftype {
+	case 0:
+		return "f32"
+	case 1:
+		return "f16"
+	case 2:
+		return "q4_0"
+	case 3:
+		return "q4_1"
+	case 4:
+		return "q4_1_some_f16"
+	case 7:
+		return "q8_0"
+	case 8:
+		return "q5_0"
+	case 9:
+		return "q5_1"
+	case 10:
+		return "q2_k"
+	case 11:
+		return "q3_k"
+	case 12:
+		return "q4_k"
+	case 13:
+		return "q5_k"
+	case 14:
+		return "q6_k"
+	}
+	return fmt.Sprintf("unknown(%d)", ftype)
+}
+
+// typeTraits describes the storage of one ggml tensor type: blockBytes
+// bytes hold blockSize elements.
+type typeTraits struct {
+	blockSize  int64
+	blockBytes int64
+}
+
+var tensorTypes = map[int32]typeTraits{
+	0:  {1, 4},     // f32
+	1:  {1, 2},     // f16
+	2:  {32, 18},   // q4_0
+	3:  {32, 20},   // q4_1
+	6:  {32, 22},   // q5_0
+	7:  {32, 24},   // q5_1
+	8:  {32, 34},   // q8_0
+	9:  {32, 36},   // q8_1
+	10: {256, 84},  // q2_K
+	11: {256, 110}, // q3_K
+	12: {256, 144}, // q4_K
+	13: {256, 176}, // q5_K
+	14: {256, 210}, // q6_K
+	15: {256, 292}, // q8_K
+	24: {1, 1},     // i8
+	25: {1, 2},     // i16
+	26: {1, 4},     // i32
+	27: {1, 8},     // i64
+	28: {1, 8},     // f64
+	30: {1, 2},     // bf16
+}
+
+// tensorBytes returns the data size of a tensor with the given type and shape.
+func tensorBytes(ttype int32, ne []int32) (int64, error) {
+	traits, ok := tensorTypes[ttype]
+	if !ok {
+		return 0, fmt.Errorf("unknown tensor type %d", ttype)
+	}
+	n := int64(1)
+	for _, d := range ne {
+		if d <= 0 {
+			return 0, fmt.Errorf("invalid tensor dimension %d", d)
+		}
+		n *= int64(d)
+	}
+	if n%traits.blockSize != 0 {
+		return 0, fmt.Errorf("tensor size %d is not a multiple of block size %d", n, traits.blockSize)
+	}
+	return n / traits.blockSize * traits.blockBytes, nil
+}
+
+// ReadModel parses a whisper model header and walks its tensor table
+// without reading tensor data. size is the total file size in bytes.
+func ReadModel(r io.ReadSeeker, size int64) (ModelInfo, error) {
+	br := bufio.NewReader(r)
+	var pos int64
+	read := func(v any) error {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return ErrTruncated
+			}
+			return err
+		}
+		pos += int64(binary.Size(v))
+		return nil
+	}
+	skip := func(n int64) error {
+		if n < 0 || pos+n > size {
+			return ErrTruncated
+		}
+		pos += n
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		br.Reset(r)
+		return nil
+	}
+
+	var magic uint32
+	if err := read(&magic); err != nil {
+		return ModelInfo{}, err
+	}
+	if magic != FileMagic {
+		return ModelInfo{}, fmt.Errorf("%w: bad magic 0x%08x", ErrNotWhisperModel, magic)
+	}
+
+	var hp Hparams
+	if err := read(&hp); err != nil {
+		return ModelInfo{}, err
+	}
+	if err := validateHparams(hp); err != nil {
+		return ModelInfo{}, err
+	}
+
+	// Mel filterbank.
+	var nMel, nFFT int32
+	if err := read(&nMel); err != nil {
+		return ModelInfo{}, err
+	}
+	if err := read(&nFFT); err != nil {
+		return ModelInfo{}, err
+	}
+	if err := skip(int64(nMel) * int64(nFFT) * 4); err != nil {
+		return ModelInfo{}, err
+	}
+
+	// Vocabulary.
+	var nVocab int32
+	if err := read(&nVocab); err != nil {
+		return ModelInfo{}, err
+	}
+	if nVocab < 0 || nVocab > hp.NVocab {
+		return ModelInfo{}, fmt.Errorf("%w: vocab size %d exceeds n_vocab %d", ErrNotWhisperModel, nVocab, hp.NVocab)
+	}
+	for i := int32(0); i < nVocab; i++ {
+		var n uint32
+		if err := read(&n); err != nil {
+			return ModelInfo{}, err
+		}
+		if _, err := br.Discard(int(n)); err != nil {
+			return ModelInfo{}, ErrTruncated
+		}
+		pos += int64(n)
+	}
+
+	// Tensors, until EOF.
+	nTensors := 0
+	for pos < size {
+		var th struct {
+			NDims   int32
+			NameLen int32
+			Type    int32
+		}
+		if err := read(&th); err != nil {
+			return ModelInfo{}, err
+		}
+		if th.NDims < 1 || th.NDims > 4 || th.NameLen < 0 || th.NameLen > 1024 {
+			return ModelInfo{}, fmt.Errorf("%w: invalid tensor header at offset %d", ErrNotWhisperModel, pos-12)
+		}
+		ne := make([]int32, th.NDims)
+		if err := read(ne); err != nil {
+			return ModelInfo{}, err
+		}
+		name := make([]byte, th.NameLen)
+		if err := read(name); err != nil {
+			return ModelInfo{}, err
+		}
+		nbytes, err := tensorBytes(th.Type, ne)
+		if err != nil {
+			return ModelInfo{}, fmt.Errorf("tensor %q: %w", name, err)
+		}
+		if err := skip(nbytes); err != nil {
+			return ModelInfo{}, fmt.Errorf("%w: tensor %q needs %d bytes at offset %d, file has %d", err, name, nbytes, pos, size)
+		}
+		nTensors++
+	}
+	if nTensors == 0 {
+		return ModelInfo{}, fmt.Errorf("%w: no tensors", ErrTruncated)
+	}
+
+	info := NewModelInfo(hp)
+	info.NTensors = nTensors
+	return info, nil
+}
+
+// validateHparams rejects header values no whisper model can have. Silero
+// VAD models share the ggml magic but start with an architecture name.
+func validateHparams(hp Hparams) error {
+	if hp.NVocab > 0 && hp.NVocab < 64 {
+		return fmt.Errorf("%w: header looks like a VAD or other non-whisper ggml model", ErrNotWhisperModel)
+	}
+	if hp.NVocab <= 0 || hp.NVocab > 1<<20 ||
+		hp.NAudioCtx <= 0 || hp.NTextCtx <= 0 ||
+		hp.NAudioState <= 0 || hp.NTextState <= 0 ||
+		hp.NAudioHead <= 0 || hp.NTextHead <= 0 ||
+		hp.NAudioLayer <= 0 || hp.NAudioLayer > 256 ||
+		hp.NTextLayer <= 0 || hp.NTextLayer > 256 ||
+		hp.NMels <= 0 || hp.NMels > 512 || hp.FType < 0 {
+		return fmt.Errorf("%w: implausible hyperparameters %+v", ErrNotWhisperModel, hp)
+	}
+	return nil
+}
+
+// InspectFile reads the model header from a file on disk.
+func InspectFile(path string) (ModelInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	return ReadModel(f, st.Size())
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 of a file.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
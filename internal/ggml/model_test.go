@@ -0,0 +1,118 @@
+package ggml
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// buildModel writes a minimal whisper model: tiny-sized hparams, a 2x2 mel
+// filterbank, two vocab entries and one f16 tensor of shape [4, 2].
+func buildModel(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := func(v any) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w(uint32(FileMagic))
+	w(Hparams{
+		NVocab: 51865, NAudioCtx: 1500, NAudioState: 384, NAudioHead: 6, NAudioLayer: 4,
+		NTextCtx: 448, NTextState: 384, NTextHead: 6, NTextLayer: 4, NMels: 80, FType: 1,
+	})
+	w(int32(2))
+	w(int32(2))
+	w([]float32{0, 0, 0, 0})
+	w(int32(2))
+	for _, word := range []string{"a", "bc"} {
+		w(uint32(len(word)))
+		buf.WriteString(word)
+	}
+	name := "encoder.conv1.weight"
+	w(int32(2))
+	w(int32(len(name)))
+	w(int32(1))
+	w([]int32{4, 2})
+	buf.WriteString(name)
+	w(make([]uint16, 8))
+	return buf.Bytes()
+}
+
+func TestReadModel(t *testing.T) {
+	data := buildModel(t)
+	info, err := ReadModel(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadModel() error: %v", err)
+	}
+	if info.Type != "tiny" || !info.Multilingual || info.Quantization != "f16" || info.NTensors != 1 {
+		t.Errorf("ReadModel() = %+v", info)
+	}
+}
+
+func TestReadModelTruncated(t *testing.T) {
+	data := buildModel(t)
+	data = data[:len(data)-4]
+	_, err := ReadModel(bytes.NewReader(data), int64(len(data)))
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("ReadModel() error = %v, want ErrTruncated", err)
+	}
+}
+
+func TestReadModelRejectsVAD(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(FileMagic))
+	binary.Write(&buf, binary.LittleEndian, int32(len("silero-16k")))
+	buf.WriteString("silero-16k")
+	buf.Write(make([]byte, 64))
+	_, err := ReadModel(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !errors.Is(err, ErrNotWhisperModel) {
+		t.Errorf("ReadModel() error = %v, want ErrNotWhisperModel", err)
+	}
+}
+
+func TestReadModelBadMagic(t *testing.T) {
+	data := []byte("RIFF0000WAVEfmt ")
+	_, err := ReadModel(bytes.NewReader(data), int64(len(data)))
+	if !errors.Is(err, ErrNotWhisperModel) {
+		t.Errorf("ReadModel() error = %v, want ErrNotWhisperModel", err)
+	}
+}
+
+func TestTransformModel(t *testing.T) {
+	data := buildModel(t)
+	var out bytes.Buffer
+	var seen []string
+	err := TransformModel(bytes.NewReader(data), &out, 2008, func(tensor *Tensor) error {
+		seen = append(seen, tensor.Name)
+		// Replace the f16 tensor with a same-shaped f32 one.
+		tensor.Type = TypeF32
+		tensor.Data = make([]byte, 4*8)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TransformModel() error: %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "encoder.conv1.weight" {
+		t.Errorf("tensors = %q, want [encoder.conv1.weight]", seen)
+	}
+
+	info, err := ReadModel(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("ReadModel() of transformed model error: %v", err)
+	}
+	if info.Quantization != "q5_0" || info.NTensors != 1 {
+		t.Errorf("transformed model = %+v", info)
+	}
+}
+
+func TestParseQuantType(t *testing.T) {
+	qt, err := ParseQuantType("Q5_0")
+	if err != nil || qt.FType != 8 || qt.TensorType != 6 {
+		t.Errorf("ParseQuantType(Q5_0) = %+v, %v", qt, err)
+	}
+	if _, err := ParseQuantType("q9_9"); err == nil {
+		t.Error("ParseQuantType(q9_9) succeeded, want error")
+	}
+}
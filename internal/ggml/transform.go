@@ -0,0 +1,201 @@
+package ggml
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Tensor element types used when rewriting models.
+const (
+	TypeF32 int32 = 0
+	TypeF16 int32 = 1
+)
+
+// QuantType is a quantized file type that models can be converted to.
+type QuantType struct {
+	Name       string
+	FType      int32 // value stored in the ftype hparam
+	TensorType int32 // ggml_type of quantized tensors
+}
+
+var quantTypes = map[string]QuantType{
+	"q4_0": {"q4_0", 2, 2},
+	"q4_1": {"q4_1", 3, 3},
+	"q5_0": {"q5_0", 8, 6},
+	"q5_1": {"q5_1", 9, 7},
+	"q8_0": {"q8_0", 7, 8},
+	"q2_k": {"q2_k", 10, 10},
+	"q3_k": {"q3_k", 11, 11},
+	"q4_k": {"q4_k", 12, 12},
+	"q5_k": {"q5_k", 13, 13},
+	"q6_k": {"q6_k", 14, 14},
+}
+
+// ParseQuantType looks up a quantization type by name, e.g. "q5_0".
+func ParseQuantType(name string) (QuantType, error) {
+	qt, ok := quantTypes[strings.ToLower(name)]
+	if !ok {
+		return QuantType{}, fmt.Errorf("unknown quantization type %q (supported: %s)", name, strings.Join(QuantTypeNames(), ", "))
+	}
+	return qt, nil
+}
+
+// QuantTypeNames returns the supported quantization type names, sorted.
+func QuantTypeNames() []string {
+	names := make([]string, 0, len(quantTypes))
+	for name := range quantTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tensor is one tensor record of a whisper model file.
+type Tensor struct {
+	Name string
+	Type int32
+	Dims []int32
+	Data []byte
+}
+
+// TensorFunc may replace a tensor's Type and Data before it is written.
+type TensorFunc func(t *Tensor) error
+
+// TransformModel copies a whisper model from r to w, storing ftype in the
+// hparams and passing every tensor through fn. The quantization version
+// must already be folded into ftype.
+func TransformModel(r io.Reader, w io.Writer, ftype int32, fn TensorFunc) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	bw := bufio.NewWriterSize(w, 1<<20)
+	read := func(v any) error {
+		if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrTruncated
+			}
+			return err
+		}
+		return nil
+	}
+	write := func(v any) error {
+		return binary.Write(bw, binary.LittleEndian, v)
+	}
+	copyN := func(n int64) error {
+		if _, err := io.CopyN(bw, br, n); err != nil {
+			if err == io.EOF {
+				return ErrTruncated
+			}
+			return err
+		}
+		return nil
+	}
+
+	var magic uint32
+	if err := read(&magic); err != nil {
+		return err
+	}
+	if magic != FileMagic {
+		return fmt.Errorf("%w: bad magic 0x%08x", ErrNotWhisperModel, magic)
+	}
+	var hp Hparams
+	if err := read(&hp); err != nil {
+		return err
+	}
+	if err := validateHparams(hp); err != nil {
+		return err
+	}
+	hp.FType = ftype
+	if err := write(magic); err != nil {
+		return err
+	}
+	if err := write(hp); err != nil {
+		return err
+	}
+
+	// Mel filterbank, copied verbatim.
+	var melDims [2]int32
+	if err := read(&melDims); err != nil {
+		return err
+	}
+	if err := write(melDims); err != nil {
+		return err
+	}
+	if err := copyN(int64(melDims[0]) * int64(melDims[1]) * 4); err != nil {
+		return err
+	}
+
+	// Vocabulary, copied verbatim.
+	var nVocab int32
+	if err := read(&nVocab); err != nil {
+		return err
+	}
+	if err := write(nVocab); err != nil {
+		return err
+	}
+	for i := int32(0); i < nVocab; i++ {
+		var n uint32
+		if err := read(&n); err != nil {
+			return err
+		}
+		if err := write(n); err != nil {
+			return err
+		}
+		if err := copyN(int64(n)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var th struct {
+			NDims   int32
+			NameLen int32
+			Type    int32
+		}
+		if err := binary.Read(br, binary.LittleEndian, &th); err == io.EOF {
+			break
+		} else if err != nil {
+			return ErrTruncated
+		}
+		if th.NDims < 1 || th.NDims > 4 || th.NameLen < 0 || th.NameLen > 1024 {
+			return fmt.Errorf("%w: invalid tensor header", ErrNotWhisperModel)
+		}
+		t := Tensor{Type: th.Type, Dims: make([]int32, th.NDims)}
+		if err := read(t.Dims); err != nil {
+			return err
+		}
+		name := make([]byte, th.NameLen)
+		if err := read(name); err != nil {
+			return err
+		}
+		t.Name = string(name)
+		nbytes, err := tensorBytes(t.Type, t.Dims)
+		if err != nil {
+			return fmt.Errorf("tensor %q: %w", t.Name, err)
+		}
+		t.Data = make([]byte, nbytes)
+		if _, err := io.ReadFull(br, t.Data); err != nil {
+			return ErrTruncated
+		}
+
+		if err := fn(&t); err != nil {
+			return fmt.Errorf("tensor %q: %w", t.Name, err)
+		}
+
+		if err := write([3]int32{int32(len(t.Dims)), int32(len(t.Name)), t.Type}); err != nil {
+			return err
+		}
+		if err := write(t.Dims); err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(t.Name); err != nil {
+			return err
+		}
+		if _, err := bw.Write(t.Data); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
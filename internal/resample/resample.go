@@ -0,0 +1,151 @@
+// Package resample converts mono audio between sample rates.
+package resample
+
+import "math"
+
+const (
+	// resampleZeros is the number of sinc zero crossings on each side of the
+	// filter kernel. More is sharper and slower.
+	resampleZeros = 16
+	// maxResamplePhases caps the kernel table for awkward rate ratios; the
+	// fractional position is then rounded to the nearest phase.
+	maxResamplePhases = 1024
+	// maxDownsample caps how far the kernel widens when downsampling, so a
+	// corrupt header rate cannot make New build gigabytes of taps. Steeper
+	// ratios keep the cutoff but get fewer zero crossings.
+	maxDownsample = 64
+)
+
+// Resampler converts a stream of mono samples from one rate to another with
+// a windowed-sinc filter, low-passed below the lower Nyquist frequency.
+// Output sample n sits at input position n*down/up.
+// A nil *Resampler passes samples through unchanged.
+type Resampler struct {
+	up, down int         // reduced output/input rate ratio
+	half     int         // kernel half-width in input samples
+	phases   int         // rows in table
+	table    [][]float32 // [phase][2*half] taps
+	buf      []float32   // pending input
+	pos      int         // next output is centred on buf[pos+half-1]
+	frac     int         // next output's fractional position, in 1/up units
+	in       int64       // total input samples seen
+	out      int64       // total output samples produced
+}
+
+// New returns a Resampler from one rate to another, or nil when the rates
+// already match.
+func New(from, to int) *Resampler {
+	if from == to {
+		return nil
+	}
+	g := gcd(from, to)
+	r := &Resampler{up: to / g, down: from / g}
+	scale := min(1, float64(to)/float64(from))
+	r.half = int(math.Ceil(resampleZeros / max(scale, 1.0/maxDownsample)))
+	r.phases = min(r.up, maxResamplePhases)
+	r.table = make([][]float32, r.phases)
+	for p := range r.table {
+		shift := float64(p) / float64(r.phases)
+		taps := make([]float32, 2*r.half)
+		var sum float64
+		for j := range taps {
+			d := float64(j-r.half+1) - shift
+			v := scale * sinc(scale*d) * blackman(d/float64(r.half))
+			taps[j] = float32(v)
+			sum += v
+		}
+		for j := range taps { // unity gain at DC
+			taps[j] = float32(float64(taps[j]) / sum)
+		}
+		r.table[p] = taps
+	}
+	// Leading silence so the first outputs have full history.
+	r.buf = make([]float32, r.half-1)
+	return r
+}
+
+// Process appends the output for in to dst.
+func (r *Resampler) Process(in, dst []float32) []float32 {
+	if r == nil {
+		return append(dst, in...)
+	}
+	r.buf = append(r.buf, in...)
+	r.in += int64(len(in))
+	return r.drain(dst, false)
+}
+
+// Flush appends the remaining output, treating the input as ended.
+func (r *Resampler) Flush(dst []float32) []float32 {
+	if r == nil {
+		return dst
+	}
+	r.buf = append(r.buf, make([]float32, r.half+1)...)
+	return r.drain(dst, true)
+}
+
+func (r *Resampler) drain(dst []float32, final bool) []float32 {
+	want := (r.in*int64(r.up) + int64(r.down) - 1) / int64(r.down) // ceil
+	for r.pos+2*r.half < len(r.buf) && (!final || r.out < want) {
+		phase := r.frac
+		if r.phases != r.up {
+			phase = (r.frac*r.phases + r.up/2) / r.up
+		}
+		window, taps := r.buf[r.pos:], r.table[0]
+		if phase < r.phases {
+			taps = r.table[phase]
+		} else { // rounded up to the next input sample
+			window = window[1:]
+		}
+		var v float32
+		for j, t := range taps {
+			v += window[j] * t
+		}
+		dst = append(dst, v)
+		r.out++
+		r.frac += r.down
+		r.pos += r.frac / r.up
+		r.frac %= r.up
+	}
+	// Drop input that no future output can reach. A steep downsample can
+	// step past the whole buffer; the rest of the step carries over.
+	if r.pos > 0 {
+		drop := min(r.pos, len(r.buf))
+		n := copy(r.buf, r.buf[drop:])
+		r.buf = r.buf[:n]
+		r.pos -= drop
+	}
+	return dst
+}
+
+// Convert resamples a whole signal.
+func Convert(samples []float32, from, to int) []float32 {
+	r := New(from, to)
+	if r == nil {
+		return samples
+	}
+	return r.Flush(r.Process(samples, make([]float32, 0, len(samples)*r.up/r.down+1)))
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// blackman is the Blackman window over x in [-1, 1].
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	t := math.Pi * (x + 1)
+	return 0.42 - 0.5*math.Cos(t) + 0.08*math.Cos(2*t)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,88 @@
+package resample
+
+import (
+	"math"
+	"testing"
+)
+
+func sine(rate, n int, freq float64) []float32 {
+	s := make([]float32, n)
+	for i := range s {
+		s[i] = float32(0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+	}
+	return s
+}
+
+func TestResample(t *testing.T) {
+	for _, rate := range []int{8000, 22050, 44100, 48000, 44056} {
+		in := sine(rate, rate, 440) // one second
+		r := New(rate, 16000)
+		got := r.Flush(r.Process(in, nil))
+		if len(got) != 16000 {
+			t.Errorf("%d Hz: got %d samples, want %d", rate, len(got), 16000)
+			continue
+		}
+		want := sine(16000, 16000, 440)
+		// Skip the edges, where the filter sees the implicit silence.
+		var maxErr float64
+		for i := 200; i < len(got)-200; i++ {
+			maxErr = max(maxErr, math.Abs(float64(got[i]-want[i])))
+		}
+		if maxErr > 0.01 {
+			t.Errorf("%d Hz: max error %.4f", rate, maxErr)
+		}
+	}
+}
+
+func TestResampleRemovesAliases(t *testing.T) {
+	// 12 kHz is above the 8 kHz Nyquist limit of the output.
+	r := New(48000, 16000)
+	got := r.Flush(r.Process(sine(48000, 48000, 12000), nil))
+	for i := 200; i < len(got)-200; i++ {
+		if math.Abs(float64(got[i])) > 0.01 {
+			t.Fatalf("sample %d = %f, want silence", i, got[i])
+		}
+	}
+}
+
+func TestResampleBlocks(t *testing.T) {
+	in := sine(44100, 44100, 300)
+	r := New(44100, 16000)
+	whole := r.Flush(r.Process(in, nil))
+
+	r = New(44100, 16000)
+	var got []float32
+	for len(in) > 0 {
+		n := min(len(in), 1000+len(got)%777)
+		got = r.Process(in[:n], got)
+		in = in[n:]
+	}
+	got = r.Flush(got)
+	if len(got) != len(whole) {
+		t.Fatalf("got %d samples in blocks, %d at once", len(got), len(whole))
+	}
+	for i := range got {
+		if got[i] != whole[i] {
+			t.Fatalf("sample %d: %f in blocks, %f at once", i, got[i], whole[i])
+		}
+	}
+}
+
+func TestResamplePassthrough(t *testing.T) {
+	if r := New(16000, 16000); r != nil {
+		t.Fatal("expected nil resampler at 16 kHz")
+	}
+}
+
+func TestResampleExtremeRatio(t *testing.T) {
+	// A corrupt header rate must not size the kernel from the raw ratio.
+	r := New(math.MaxUint32, 16000)
+	if r.half > resampleZeros*maxDownsample || len(r.table) > maxResamplePhases {
+		t.Fatalf("kernel of %d phases x %d taps", len(r.table), 2*r.half)
+	}
+	got := r.Process(make([]float32, 1<<16), nil)
+	got = r.Flush(r.Process(make([]float32, 1<<16), got))
+	if len(got) != 1 {
+		t.Errorf("got %d samples from %d, want 1", len(got), 1<<17)
+	}
+}
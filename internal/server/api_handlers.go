@@ -1,12 +1,18 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"os/exec"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -49,6 +55,8 @@ func (s *Server) handleModelLoad(w http.ResponseWriter, r *http.Request) {
 		Path      string `json:"path"`
 		GpuDevice *int   `json:"gpu_device,omitempty"` // optional; nil = whisper default
 		NoGpu     bool   `json:"no_gpu,omitempty"`
+		FlashAttn bool   `json:"flash_attn,omitempty"`
+		DTW       string `json:"dtw,omitempty"` // alignment-heads preset or "auto"
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Path == "" {
 		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "request body must contain {\"path\": \"...\"}")
@@ -60,7 +68,13 @@ func (s *Server) handleModelLoad(w http.ResponseWriter, r *http.Request) {
 		gpuDevice = *body.GpuDevice
 	}
 
-	if err := s.LoadModel(body.Path, gpuDevice, body.NoGpu); err != nil {
+	opts := whisper.ContextOptions{
+		GPUDevice: gpuDevice,
+		NoGPU:     body.NoGpu,
+		FlashAttn: body.FlashAttn,
+		DTW:       body.DTW,
+	}
+	if err := s.LoadModel(body.Path, opts); err != nil {
 		writeError(w, http.StatusInternalServerError, ErrCodeInternalError, "failed to load model: "+err.Error())
 		return
 	}
@@ -96,37 +110,158 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
-	file, _, err := r.FormFile("file")
+	// Raw PCM is decoded straight from the body; anything else is a file.
+	pcm, err := audio.ParsePCMType(r.Header.Get("Content-Type"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "missing or invalid 'file' field: "+err.Error())
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
 		return
 	}
-	defer file.Close()
+	var file multipart.File
+	if pcm != nil {
+		r.ParseForm()
+	} else {
+		var cleanup func()
+		file, cleanup, err = s.requestFile(r)
+		if err != nil {
+			writeRequestFileError(w, err)
+			return
+		}
+		defer cleanup()
+	}
+
+	stats := newRequestStats()
+	stats.gpu = s.ctx.UsesGPU()
 
 	diarizeModel := r.FormValue("diarize_model")
+	offset := parseFloat64FormValue(r.FormValue("offset"))
+	duration := parseFloat64FormValue(r.FormValue("duration"))
+	if offset < 0 || duration < 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'offset' and 'duration' must not be negative")
+		return
+	}
+	var audioTrack int
+	if v := r.FormValue("audio_stream"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'audio_stream' must be a non-negative integer")
+			return
+		}
+		audioTrack = n + 1
+	}
+	var audioCtx int
+	if v := r.FormValue("audio_ctx"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > whisper.MaxAudioCtx {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("'audio_ctx' must be an integer from 0 to %d", whisper.MaxAudioCtx))
+			return
+		}
+		audioCtx = n
+	}
+	// Decoding stops one sample past the length limits, so a file over them
+	// is rejected without holding all of it in memory. capped marks audio
+	// that may have been cut short this way.
+	readOpts := audio.ReadOptions{
+		Offset:     offset,
+		Duration:   s.limitDuration(duration),
+		AudioTrack: audioTrack,
+	}
+	capped := readOpts.Duration != duration
+	enhanceAudio := parseBoolFormValue(r.FormValue("enhance_audio"))
+	chunkLength := parseFloat64FormValue(r.FormValue("chunk_length"))
+	if chunkLength < 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'chunk_length' must not be negative")
+		return
+	}
+	filters, err := audio.ParseFilters(strings.Join(r.Form["audio_filters"], ","))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid 'audio_filters': "+err.Error())
+		return
+	}
+	if chunkLength > 0 {
+		if err := audio.StreamFilters(filters); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'audio_filters' cannot be used with 'chunk_length': "+err.Error())
+			return
+		}
+	}
+	readOpts.Filters = filters
+	var splitChannels bool
+	switch channels := r.FormValue("channels"); channels {
+	case "", "mix":
+	case "split":
+		splitChannels = true
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'channels' must be \"mix\" or \"split\"")
+		return
+	}
+	if splitChannels && diarizeModel != "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'channels=split' cannot be combined with 'diarize_model'")
+		return
+	}
+	if splitChannels && chunkLength > 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'channels=split' cannot be combined with 'chunk_length'")
+		return
+	}
+	if pcm != nil {
+		for _, opt := range []struct {
+			field string
+			set   bool
+		}{
+			{"diarize_model", diarizeModel != ""},
+			{"chunk_length", chunkLength > 0},
+			{"channels", splitChannels},
+			{"audio_stream", audioTrack > 0},
+		} {
+			if opt.set {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'"+opt.field+"' is not supported with raw PCM input")
+				return
+			}
+		}
+	}
+
+	// decodeCtx bounds decoding the audio up front. The ffmpeg processes it
+	// starts are killed when the client disconnects or it times out.
+	decodeCtx, cancelDecode := stageContext(r.Context(), s.DecodeTimeout)
+	defer cancelDecode()
 
-	// If diarization requested, save upload to temp file, then convert to
-	// native 16kHz mono PCM WAV so sona-diarize can read it. The converted
-	// file is also used for whisper (skips its own ffmpeg pass).
+	// If diarization requested, convert the audio (spilled to disk if the
+	// upload is in memory) to native 16kHz mono PCM WAV so sona-diarize can
+	// read it. The converted file is also used for whisper (skips its own
+	// ffmpeg pass).
 	var tempAudioPath string
 	var fileReader io.ReadSeeker = file
 	if diarizeModel != "" {
-		tmp, tmpErr := os.CreateTemp("", "sona-diar-*.audio")
-		if tmpErr != nil {
-			writeError(w, http.StatusInternalServerError, ErrCodeInternalError, "failed to create temp file: "+tmpErr.Error())
+		inputPath, cleanup, pathErr := uploadPath(file)
+		if pathErr != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternalError, pathErr.Error())
 			return
 		}
-		defer os.Remove(tmp.Name())
-		if _, copyErr := io.Copy(tmp, file); copyErr != nil {
-			tmp.Close()
-			writeError(w, http.StatusInternalServerError, ErrCodeInternalError, "failed to buffer upload: "+copyErr.Error())
+		defer cleanup()
+		// Reject audio the container says is too long before converting it.
+		// Without ffprobe the converted length is checked instead.
+		if info, probeErr := audio.ProbeFile(decodeCtx, inputPath); probeErr == nil && info.Duration > 0 {
+			seconds := max(info.Duration-offset, 0)
+			if duration > 0 {
+				seconds = min(seconds, duration)
+			}
+			if err := s.checkAudioLength(seconds, int64(seconds*audio.SampleRate), false); err != nil {
+				writeAudioTooLong(w, err)
+				return
+			}
+		}
+		tmp, tmpErr := os.CreateTemp("", "sona-diar-*.wav")
+		if tmpErr != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternalError, "failed to create temp file: "+tmpErr.Error())
 			return
 		}
 		tmp.Close()
+		defer os.Remove(tmp.Name())
 
 		// Convert to native WAV for diarization (and reuse for whisper).
-		nativeWav := tmp.Name() + ".wav"
-		if convErr := audio.ConvertToNativeWav(tmp.Name(), nativeWav, false); convErr != nil {
+		nativeWav := tmp.Name()
+		if convErr := audio.ConvertToNativeWav(decodeCtx, inputPath, nativeWav, audio.ReadOptions{Offset: offset, Duration: readOpts.Duration, AudioTrack: audioTrack}); convErr != nil {
+			if stageStopped(decodeCtx, w, r, "audio decoding", s.DecodeTimeout) {
+				return
+			}
 			log.Printf("failed to convert audio to native WAV: %v", convErr)
 			writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "failed to convert audio for diarization: "+convErr.Error())
 			return
@@ -142,39 +277,152 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 		}
 		defer reopened.Close()
 		fileReader = reopened
+		// The converted file already covers only the requested range and stream.
+		readOpts.Offset = 0
+		readOpts.Duration = 0
+		readOpts.AudioTrack = 0
 	}
 
-	samples, err := audio.ReadWithOptions(fileReader, audio.ReadOptions{
-		EnhanceAudio: parseBoolFormValue(r.FormValue("enhance_audio")),
-	})
-	if err != nil {
-		writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "invalid audio file: "+err.Error())
-		return
+	// transcribe runs whisper over the audio. With chunk_length the audio is
+	// decoded from disk chunk by chunk during transcription instead of up
+	// front, keeping memory flat for long recordings. With channels=split each
+	// channel is transcribed on its own and the segments are merged. With
+	// enhance_audio long pauses are cut out, and timeMap maps timestamps
+	// back to the uploaded audio.
+	var transcribe func(opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error)
+	var timeMap func() audio.TimeMap
+	var chunks *chunkSource
+	if chunkLength > 0 {
+		audioPath := tempAudioPath
+		if audioPath == "" {
+			path, cleanup, pathErr := uploadPath(file)
+			if pathErr != nil {
+				writeError(w, http.StatusInternalServerError, ErrCodeInternalError, pathErr.Error())
+				return
+			}
+			defer cleanup()
+			audioPath = path
+		}
+		// The stream is read during transcription, so it lives as long as the request.
+		stream, streamErr := audio.OpenStream(r.Context(), audioPath, readOpts)
+		if streamErr != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "invalid audio file: "+streamErr.Error())
+			return
+		}
+		defer stream.Close()
+		// The length is known up front only for WAVs; otherwise the limits
+		// are checked as chunks are decoded.
+		if total := stream.Total(); total > 0 {
+			if err := s.checkAudioLength(float64(total)/audio.SampleRate, total, capped); err != nil {
+				writeAudioTooLong(w, err)
+				return
+			}
+		}
+		if enhanceAudio {
+			stream.RemoveSilence()
+			timeMap = stream.TimeMap
+		}
+		chunks = &chunkSource{
+			Chunker: audio.NewChunker(stream, chunkLength),
+			check: func(seconds float64) error {
+				return s.checkAudioLength(seconds, int64(seconds*audio.SampleRate), true)
+			},
+		}
+		transcribe = func(opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+			result, err := whisper.TranscribeChunks(s.ctx, chunks, opts, cb)
+			stats.audioDecode = chunks.DecodeTime()
+			stats.audioDuration = chunks.Consumed()
+			return result, err
+		}
+	} else if splitChannels {
+		channels, numbers, err := audio.ReadChannels(decodeCtx, fileReader, readOpts)
+		if err != nil {
+			if stageStopped(decodeCtx, w, r, "audio decoding", s.DecodeTimeout) {
+				return
+			}
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "invalid audio file: "+err.Error())
+			return
+		}
+		if len(channels) == 0 || len(channels[0]) == 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "audio file contains no samples")
+			return
+		}
+		n := len(channels[0])
+		if err := s.checkAudioLength(float64(n)/audio.SampleRate, int64(n*len(channels)), capped); err != nil {
+			writeAudioTooLong(w, err)
+			return
+		}
+		stats.audioDecode = time.Since(stats.start)
+		stats.audioDuration = float64(len(channels[0])) / audio.SampleRate
+		if enhanceAudio {
+			var cuts audio.TimeMap
+			channels, cuts = audio.RemoveSilenceChannels(channels)
+			timeMap = func() audio.TimeMap { return cuts }
+		}
+		transcribe = func(opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+			return whisper.TranscribeChannels(s.ctx, channels, numbers, opts, cb)
+		}
+	} else {
+		var samples []float32
+		if pcm != nil {
+			samples, err = audio.ReadPCM(decodeCtx, r.Body, *pcm, readOpts)
+		} else {
+			samples, err = audio.ReadWithOptions(decodeCtx, fileReader, readOpts)
+		}
+		if err != nil {
+			if stageStopped(decodeCtx, w, r, "audio decoding", s.DecodeTimeout) {
+				return
+			}
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "invalid audio file: "+err.Error())
+			return
+		}
+		if len(samples) == 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "audio file contains no samples")
+			return
+		}
+		if err := s.checkAudioLength(float64(len(samples))/audio.SampleRate, int64(len(samples)), capped); err != nil {
+			writeAudioTooLong(w, err)
+			return
+		}
+		stats.audioDecode = time.Since(stats.start)
+		stats.audioDuration = float64(len(samples)) / audio.SampleRate
+		if enhanceAudio {
+			var cuts audio.TimeMap
+			samples, cuts = audio.RemoveSilence(samples)
+			timeMap = func() audio.TimeMap { return cuts }
+		}
+		transcribe = func(opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+			return s.ctx.TranscribeStream(samples, opts, cb)
+		}
 	}
-	if len(samples) == 0 {
-		writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "audio file contains no samples")
-		return
+
+	if timeMap != nil {
+		transcribe = remapTranscription(transcribe, timeMap, offset)
 	}
 
 	// Start diarization in background if requested.
 	type diarResult struct {
 		segments []diarize.Segment
 		err      error
+		elapsed  time.Duration
 	}
 	var diarCh chan diarResult
 	if diarizeModel != "" && tempAudioPath != "" {
 		diarCh = make(chan diarResult, 1)
 		go func() {
-			segs, dErr := diarize.Diarize(diarizeModel, tempAudioPath)
-			diarCh <- diarResult{segs, dErr}
+			ctx, cancel := stageContext(r.Context(), s.DiarizeTimeout)
+			defer cancel()
+			diarStart := time.Now()
+			segs, dErr := diarize.Diarize(ctx, diarizeModel, tempAudioPath)
+			diarCh <- diarResult{shiftDiarSegments(segs, offset), dErr, time.Since(diarStart)}
 		}()
 	}
 
 	samplingStrategy := r.FormValue("sampling_strategy")
 	stableTimestamps := parseBoolFormValue(r.FormValue("stable_timestamps"))
 	vadModelPath := r.FormValue("vad_model")
-	if stableTimestamps && vadModelPath == "" {
-		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'vad_model' is required when 'stable_timestamps' is true")
+	if stableTimestamps && parseIntFormValue(r.FormValue("parallel_chunks")) > 1 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "'parallel_chunks' cannot be combined with 'stable_timestamps'")
 		return
 	}
 
@@ -194,6 +442,18 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 		BeamSize:         parseIntFormValue(r.FormValue("beam_size")),
 		StableTimestamps: stableTimestamps,
 		VadModelPath:     vadModelPath,
+		Hotwords:         parseListFormValue(r.Form["hotwords"]),
+		HotwordBoost:     parseFloatFormValue(r.FormValue("hotword_boost")),
+		SuppressWords:    parseListFormValue(r.Form["suppress_words"]),
+		SuppressRegex:    r.FormValue("suppress_regex"),
+		TimeOffset:       offset,
+		AudioCtx:         audioCtx,
+		SingleSegment:    parseBoolFormValue(r.FormValue("single_segment")),
+		ParallelChunks:   parseIntFormValue(r.FormValue("parallel_chunks")),
+	}
+	sessionID := r.FormValue("session_id")
+	if sessionID != "" {
+		opts.PromptTokens = s.sessions.get(sessionID, s.SessionTTL, time.Now())
 	}
 
 	responseFormat := r.FormValue("response_format")
@@ -203,30 +463,42 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 
 	stream := parseBoolFormValue(r.FormValue("stream"))
 
+	// transcribeCtx aborts whisper when the client disconnects or it times
+	// out.
+	transcribeCtx, cancelTranscribe := stageContext(r.Context(), s.TranscribeTimeout)
+	defer cancelTranscribe()
+
 	if stream {
 		// Run diarization before streaming so speaker labels are available for each segment.
 		var diarStreamSegments []diarize.Segment
 		if diarizeModel != "" && tempAudioPath != "" {
-			segs, dErr := diarize.Diarize(diarizeModel, tempAudioPath)
+			ctx, cancel := stageContext(r.Context(), s.DiarizeTimeout)
+			diarStart := time.Now()
+			segs, dErr := diarize.Diarize(ctx, diarizeModel, tempAudioPath)
+			cancel()
+			stats.diarize = time.Since(diarStart)
 			if dErr != nil {
 				log.Printf("diarization failed (streaming without speakers): %v", dErr)
 			} else {
-				diarStreamSegments = segs
+				diarStreamSegments = shiftDiarSegments(segs, offset)
 			}
 		}
-		s.handleStreamingTranscription(w, r, samples, opts, diarStreamSegments)
+		s.handleStreamingTranscription(transcribeCtx, w, r, func(cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+			return transcribe(opts, cb)
+		}, diarStreamSegments, stats)
 		return
 	}
 
-	// Non-streaming: set up abort on client disconnect.
+	// Non-streaming: set up abort on client disconnect or timeout.
 	var aborted atomic.Bool
 	go func() {
-		<-r.Context().Done()
+		<-transcribeCtx.Done()
 		aborted.Store(true)
 	}()
 
 	var result whisper.TranscribeResult
 	var transcribeErr error
+	transcribeStart := time.Now()
 	func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -234,13 +506,23 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 				log.Printf("panic during transcription: %v", r)
 			}
 		}()
-		result, transcribeErr = s.ctx.TranscribeStream(samples, opts, whisper.StreamCallbacks{
+		result, transcribeErr = transcribe(opts, whisper.StreamCallbacks{
 			ShouldAbort: func() bool { return aborted.Load() },
 		})
 	}()
+	stats.transcribe = time.Since(transcribeStart)
 	if transcribeErr != nil {
-		if aborted.Load() {
-			return // client gone, nothing to write
+		if aborted.Load() && stageStopped(transcribeCtx, w, r, "transcription", s.TranscribeTimeout) {
+			return
+		}
+		var tooLong *audioTooLongError
+		if errors.As(transcribeErr, &tooLong) {
+			writeAudioTooLong(w, tooLong)
+			return
+		}
+		if chunks != nil && chunks.err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "invalid audio file: "+chunks.err.Error())
+			return
 		}
 		writeError(w, http.StatusInternalServerError, ErrCodeInternalError, "transcription failed: "+transcribeErr.Error())
 		return
@@ -250,6 +532,7 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 	var diarSegments []diarize.Segment
 	if diarCh != nil {
 		dr := <-diarCh
+		stats.diarize = dr.elapsed
 		if dr.err != nil {
 			log.Printf("diarization failed (skipping): %v", dr.err)
 		} else {
@@ -257,10 +540,18 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	s.rememberSession(sessionID, result)
+	stats.whisper = result.Timings
+	stats.finish()
+	stats.setHeaders(w.Header())
+
 	switch responseFormat {
 	case "verbose_json":
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(buildVerboseJSON(result.Segments, diarSegments))
+		v := buildVerboseJSON(result.Segments, diarSegments)
+		usage, timings := stats.usage(), stats.timings()
+		v.Usage, v.Timings = &usage, &timings
+		json.NewEncoder(w).Encode(v)
 	case "text":
 		w.Header().Set("Content-Type", "text/plain")
 		io.WriteString(w, result.Text())
@@ -276,9 +567,39 @@ func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleProbe describes an uploaded media file and its audio streams, so a
+// client can pick audio_stream before transcribing.
+func (s *Server) handleProbe(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, cleanup, err := s.requestFile(r)
+	if err != nil {
+		writeRequestFileError(w, err)
+		return
+	}
+	defer cleanup()
+
+	ctx, cancel := stageContext(r.Context(), s.DecodeTimeout)
+	defer cancel()
+	result, err := audio.Probe(ctx, file)
+	if err != nil && stageStopped(ctx, w, r, "probing", s.DecodeTimeout) {
+		return
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternalError, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidAudio, "invalid media file: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
 // handleStreamingTranscription writes newline-delimited JSON events
-// as segments and progress updates arrive during transcription.
-func (s *Server) handleStreamingTranscription(w http.ResponseWriter, r *http.Request, samples []float32, opts whisper.TranscribeOptions, diarSegments []diarize.Segment) {
+// as segments and progress updates arrive during transcription, which is
+// aborted when ctx is done.
+func (s *Server) handleStreamingTranscription(ctx context.Context, w http.ResponseWriter, r *http.Request, transcribe func(whisper.StreamCallbacks) (whisper.TranscribeResult, error), diarSegments []diarize.Segment, stats *requestStats) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		writeError(w, http.StatusInternalServerError, ErrCodeInternalError, "streaming not supported")
@@ -294,7 +615,7 @@ func (s *Server) handleStreamingTranscription(w http.ResponseWriter, r *http.Req
 
 	var aborted atomic.Bool
 	go func() {
-		<-r.Context().Done()
+		<-ctx.Done()
 		aborted.Store(true)
 	}()
 
@@ -313,10 +634,14 @@ func (s *Server) handleStreamingTranscription(w http.ResponseWriter, r *http.Req
 				"end":   csToSeconds(seg.End),
 				"text":  seg.Text,
 			}
-			if diarSegments != nil {
-				if sp := matchSpeaker(csToSeconds(seg.Start), csToSeconds(seg.End), diarSegments); sp >= 0 {
-					event["speaker"] = sp
-				}
+			if len(seg.Words) > 0 {
+				event["words"] = buildVerboseWords([]whisper.Segment{seg})
+			}
+			if seg.Channel > 0 {
+				event["channel"] = seg.Channel
+			}
+			if sp := segmentSpeaker(seg, diarSegments); sp >= 0 {
+				event["speaker"] = sp
 			}
 			enc.Encode(event)
 			flusher.Flush()
@@ -326,6 +651,7 @@ func (s *Server) handleStreamingTranscription(w http.ResponseWriter, r *http.Req
 
 	var result whisper.TranscribeResult
 	var transcribeErr error
+	transcribeStart := time.Now()
 	func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -333,41 +659,121 @@ func (s *Server) handleStreamingTranscription(w http.ResponseWriter, r *http.Req
 				log.Printf("panic during streaming transcription: %v", r)
 			}
 		}()
-		result, transcribeErr = s.ctx.TranscribeStream(samples, opts, cb)
+		result, transcribeErr = transcribe(cb)
 	}()
+	stats.transcribe = time.Since(transcribeStart)
 	if transcribeErr != nil {
-		if !aborted.Load() {
-			enc.Encode(map[string]any{
-				"type":    "error",
-				"message": transcribeErr.Error(),
-			})
-			flusher.Flush()
+		if r.Context().Err() != nil {
+			return // client gone, nothing to write
+		}
+		event := map[string]any{
+			"type":    "error",
+			"message": transcribeErr.Error(),
+		}
+		var tooLong *audioTooLongError
+		if errors.As(transcribeErr, &tooLong) {
+			event["code"] = ErrCodeAudioTooLong
 		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			event["message"] = fmt.Sprintf("transcription timed out after %s", s.TranscribeTimeout)
+			event["code"] = ErrCodeTimeout
+		}
+		enc.Encode(event)
+		flusher.Flush()
 		return
 	}
 
+	s.rememberSession(r.FormValue("session_id"), result)
+
 	// Final result line.
+	stats.whisper = result.Timings
+	stats.finish()
 	enc.Encode(map[string]any{
-		"type": "result",
-		"text": result.Text(),
+		"type":    "result",
+		"text":    result.Text(),
+		"usage":   stats.usage(),
+		"timings": stats.timings(),
 	})
 	flusher.Flush()
 }
 
+// stageContext derives the context of a request stage, bounded by timeout
+// unless it is zero.
+func stageContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// stageStopped reports whether a stage failed because ctx is done. It writes
+// a timeout error if the stage ran out of time, and nothing if the client
+// has gone away.
+func stageStopped(ctx context.Context, w http.ResponseWriter, r *http.Request, stage string, timeout time.Duration) bool {
+	if r.Context().Err() != nil {
+		return true
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, fmt.Sprintf("%s timed out after %s", stage, timeout))
+		return true
+	}
+	return false
+}
+
+// rememberSession appends a result's tokens to its dictation session.
+// Callers must hold s.mu.
+func (s *Server) rememberSession(id string, result whisper.TranscribeResult) {
+	if id == "" {
+		return
+	}
+	s.sessions.append(id, s.ctx.Tokenize(result.Text()), s.SessionTokens, s.SessionTTL, time.Now())
+}
+
+// handleSessionReset forgets a dictation session's context (idempotent).
+func (s *Server) handleSessionReset(w http.ResponseWriter, r *http.Request) {
+	s.sessions.reset(r.PathValue("id"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "reset"})
+}
+
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
 	s.mu.Lock()
 	name := s.modelName
 	loaded := s.ctx != nil
+	meta := s.model
+	hash := s.modelHash()
+	var ctxOpts whisper.ContextOptions
+	if loaded {
+		ctxOpts = s.ctx.Options()
+	}
 	s.mu.Unlock()
 
 	var data []map[string]any
 	if loaded {
+		// null until the background hash finishes.
+		var sha256 any
+		if !meta.ModTime.IsZero() {
+			if sum := s.hashes.get(hash); sum != "" {
+				sha256 = sum
+			}
+		}
 		data = []map[string]any{
 			{
-				"id":       name,
-				"object":   "model",
-				"created":  time.Now().Unix(),
-				"owned_by": "local",
+				"id":           name,
+				"object":       "model",
+				"created":      meta.ModTime.Unix(),
+				"owned_by":     "local",
+				"size":         meta.Size,
+				"sha256":       sha256,
+				"loaded_at":    meta.LoadedAt.Unix(),
+				"load_time_ms": meta.LoadTime.Milliseconds(),
+				"metadata":     meta.Info,
+				"context_params": map[string]any{
+					"use_gpu":    !ctxOpts.NoGPU,
+					"gpu_device": ctxOpts.GPUDevice,
+					"flash_attn": ctxOpts.FlashAttn,
+					"dtw":        ctxOpts.DTW,
+				},
 			},
 		}
 	} else {
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+)
+
+// chunkSource feeds whisper.TranscribeChunks and remembers decode failures
+// so they can be reported as invalid audio rather than transcription errors.
+// check, if set, is called with the seconds decoded so far and stops the
+// transcription with its error.
+type chunkSource struct {
+	*audio.Chunker
+	check func(seconds float64) error
+	err   error
+}
+
+func (c *chunkSource) Next() ([]float32, float64, error) {
+	samples, start, err := c.Chunker.Next()
+	if err == nil && c.check != nil {
+		err = c.check(c.Consumed())
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		c.err = err
+	}
+	return samples, start, err
+}
+
+// uploadPath returns a path on disk holding the uploaded file, spilling it
+// to a temp file when the multipart reader kept it in memory.
+func uploadPath(file multipart.File) (string, func(), error) {
+	if f, ok := file.(*os.File); ok {
+		return f.Name(), func() {}, nil
+	}
+	tmp, err := os.CreateTemp("", "sona-*.audio")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+	_, err = io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to buffer upload: %w", err)
+	}
+	return tmp.Name(), cleanup, nil
+}
@@ -7,14 +7,17 @@ import (
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/danielgtaylor/huma/v2/adapters/humago"
+	"github.com/thewh1teagle/sona/internal/audio"
 )
 
 type docsTranscriptionForm struct {
 	File           huma.FormFile `form:"file"`
+	FilePath       string        `form:"file_path" doc:"read the audio from this server path instead of an upload (needs --allow-path)"`
 	Language       string        `form:"language"`
 	Prompt         string        `form:"prompt"`
 	DetectLanguage bool          `form:"detect_language"`
 	EnhanceAudio   bool          `form:"enhance_audio"`
+	AudioFilters   string        `form:"audio_filters" doc:"comma-separated preprocessing steps, e.g. highpass=f=80,afftdn,normalize"`
 	ResponseFormat string        `form:"response_format"`
 	Stream         bool          `form:"stream"`
 	Model          string        `form:"model"`
@@ -28,8 +31,21 @@ type docsTranscriptionForm struct {
 	StabTimestamps bool          `form:"stable_timestamps"`
 	Temperature    float32       `form:"temperature"`
 	Translate      bool          `form:"translate"`
-	VadModel       string        `form:"vad_model"`
+	VadModel       string        `form:"vad_model" doc:"GGML VAD model for stable_timestamps; without it a built-in energy VAD is used"`
 	WordTimestamps bool          `form:"word_timestamps"`
+	Hotwords       string        `form:"hotwords"`
+	HotwordBoost   float32       `form:"hotword_boost"`
+	SuppressWords  string        `form:"suppress_words"`
+	SuppressRegex  string        `form:"suppress_regex"`
+	Offset         float64       `form:"offset"`
+	Duration       float64       `form:"duration"`
+	AudioCtx       int           `form:"audio_ctx" minimum:"0" maximum:"1500" doc:"encoder audio context size (0 = model default; smaller is faster)"`
+	SingleSegment  bool          `form:"single_segment"`
+	SessionID      string        `form:"session_id"`
+	ChunkLength    float64       `form:"chunk_length"`
+	ParallelChunks int           `form:"parallel_chunks"`
+	Channels       string        `form:"channels" enum:"mix,split"`
+	AudioStream    int           `form:"audio_stream" doc:"index among the file's audio streams (see /v1/audio/probe)"`
 }
 
 type docsTranscriptionInput struct {
@@ -42,13 +58,28 @@ type docsTranscriptionOutput struct {
 	}
 }
 
+type docsProbeForm struct {
+	File     huma.FormFile `form:"file"`
+	FilePath string        `form:"file_path" doc:"read the media from this server path instead of an upload (needs --allow-path)"`
+}
+
+type docsProbeInput struct {
+	RawBody huma.MultipartFormFiles[docsProbeForm]
+}
+
+type docsProbeOutput struct {
+	Body audio.ProbeResult
+}
+
 type docsModelsOutput struct {
 	Body map[string]any
 }
 
 type docsModelLoadInput struct {
 	Body struct {
-		Path string `json:"path"`
+		Path      string `json:"path"`
+		FlashAttn bool   `json:"flash_attn,omitempty"`
+		DTW       string `json:"dtw,omitempty" doc:"DTW alignment-heads preset for word timestamps (auto, tiny, base.en, large.v3, ...)"`
 	}
 }
 
@@ -59,6 +90,10 @@ type docsModelLoadOutput struct {
 	}
 }
 
+type docsSessionResetInput struct {
+	ID string `path:"id"`
+}
+
 type docsStatusOutput struct {
 	Body struct {
 		Status string `json:"status"`
@@ -83,10 +118,22 @@ func (s *Server) registerDocsRoutes(mux *http.ServeMux) {
 		Path:        "/v1/audio/transcriptions",
 		OperationID: "createTranscription",
 		Summary:     "Create transcription",
+		Description: "Fields may also be sent as a JSON object (Content-Type: application/json) together with file_path, " +
+			"or as query parameters with the audio as the raw body (audio/* or application/octet-stream). " +
+			"Raw PCM (audio/L16;rate=16000;channels=1 or audio/f32le) is decoded without ffmpeg.",
 	}, func(context.Context, *docsTranscriptionInput) (*docsTranscriptionOutput, error) {
 		return nil, huma.Error501NotImplemented("spec-only operation")
 	})
 
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/v1/audio/probe",
+		OperationID: "probeMedia",
+		Summary:     "Describe a media file's container and audio streams",
+	}, func(context.Context, *docsProbeInput) (*docsProbeOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
 	huma.Register(api, huma.Operation{
 		Method:      http.MethodGet,
 		Path:        "/v1/models",
@@ -114,6 +161,15 @@ func (s *Server) registerDocsRoutes(mux *http.ServeMux) {
 		return nil, huma.Error501NotImplemented("spec-only operation")
 	})
 
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/v1/sessions/{id}",
+		OperationID: "resetSession",
+		Summary:     "Forget a dictation session's context",
+	}, func(context.Context, *docsSessionResetInput) (*docsStatusOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
 	huma.Register(api, huma.Operation{
 		Method:      http.MethodGet,
 		Path:        "/health",
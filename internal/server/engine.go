@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/thewh1teagle/sona/internal/ggml"
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// Engine loads models for the server.
+type Engine interface {
+	Load(path string, opts whisper.ContextOptions) (Transcriber, error)
+}
+
+// Transcriber is a loaded model. The server serializes all calls, so
+// implementations need not be safe for concurrent use.
+type Transcriber interface {
+	TranscribeStream(samples []float32, opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error)
+	// Tokenize converts text to the model's token ids (for session context).
+	Tokenize(text string) []int32
+	Options() whisper.ContextOptions
+	ModelInfo() ggml.ModelInfo
+	UsesGPU() bool
+	Close()
+}
+
+// WhisperEngine loads models with whisper.cpp.
+type WhisperEngine struct{}
+
+func (WhisperEngine) Load(path string, opts whisper.ContextOptions) (Transcriber, error) {
+	ctx, err := whisper.New(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
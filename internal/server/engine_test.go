@@ -0,0 +1,807 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+	"github.com/thewh1teagle/sona/internal/ggml"
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// fakeEngine loads fakeTranscribers that replay a script instead of running
+// a model.
+type fakeEngine struct {
+	model *fakeTranscriber
+}
+
+func (e *fakeEngine) Load(path string, opts whisper.ContextOptions) (Transcriber, error) {
+	if e.model == nil {
+		return nil, errors.New("fake: no model")
+	}
+	e.model.opts = opts
+	return e.model, nil
+}
+
+// fakeTranscriber emits its segments in order, reporting progress after each
+// and sleeping delay before each. Like the real engine, segments are moved
+// later by opts.TimeOffset. With a non-nil release channel it blocks after
+// signalling started until release is closed or the caller aborts.
+type fakeTranscriber struct {
+	segments []whisper.Segment
+	delay    time.Duration
+	err      error // returned after all segments are emitted
+	started  chan struct{}
+	release  chan struct{}
+
+	mu      sync.Mutex
+	opts    whisper.ContextOptions
+	calls   []whisper.TranscribeOptions
+	lengths []int // len(samples) per call
+	aborted bool
+	closed  bool
+}
+
+var errFakeAborted = errors.New("fake: aborted")
+
+func (f *fakeTranscriber) TranscribeStream(samples []float32, opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, opts)
+	f.lengths = append(f.lengths, len(samples))
+	f.mu.Unlock()
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+
+	shouldAbort := func() bool {
+		if cb.ShouldAbort != nil && cb.ShouldAbort() {
+			f.mu.Lock()
+			f.aborted = true
+			f.mu.Unlock()
+			return true
+		}
+		return false
+	}
+	if f.release != nil {
+		for waiting := true; waiting; {
+			select {
+			case <-f.release:
+				waiting = false
+			case <-time.After(time.Millisecond):
+				if shouldAbort() {
+					return whisper.TranscribeResult{}, errFakeAborted
+				}
+			}
+		}
+	}
+
+	shift := int64(math.Round(opts.TimeOffset * 100))
+	var result whisper.TranscribeResult
+	for i, seg := range f.segments {
+		seg.Start += shift
+		seg.End += shift
+		time.Sleep(f.delay)
+		if shouldAbort() {
+			return whisper.TranscribeResult{}, errFakeAborted
+		}
+		if cb.OnSegment != nil {
+			cb.OnSegment(seg)
+		}
+		if cb.OnProgress != nil {
+			cb.OnProgress((i + 1) * 100 / len(f.segments))
+		}
+		result.Segments = append(result.Segments, seg)
+	}
+	if f.err != nil {
+		return whisper.TranscribeResult{}, f.err
+	}
+	return result, nil
+}
+
+func (f *fakeTranscriber) Tokenize(text string) []int32 {
+	tokens := make([]int32, len(strings.Fields(text)))
+	for i := range tokens {
+		tokens[i] = int32(i + 1)
+	}
+	return tokens
+}
+
+func (f *fakeTranscriber) Options() whisper.ContextOptions { return f.opts }
+func (f *fakeTranscriber) ModelInfo() ggml.ModelInfo       { return ggml.ModelInfo{Type: "tiny"} }
+func (f *fakeTranscriber) UsesGPU() bool                   { return false }
+
+func (f *fakeTranscriber) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+}
+
+// newFakeServer returns a server with the fake model already loaded.
+func newFakeServer(t *testing.T, model *fakeTranscriber) *Server {
+	t.Helper()
+	s := NewWithEngine(&fakeEngine{model: model}, false)
+	if err := s.LoadModel("fake.bin", whisper.ContextOptions{GPUDevice: -1}); err != nil {
+		t.Fatalf("LoadModel() error: %v", err)
+	}
+	return s
+}
+
+// testWAV returns one second of native 16 kHz mono 16-bit silence.
+func testWAV() []byte {
+	return pcmWAV(make([]int16, 16000), 1)
+}
+
+// pcmWAV returns a 16 kHz 16-bit WAV of interleaved samples.
+func pcmWAV(samples []int16, channels int) []byte {
+	n := len(samples)
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	w(uint32(36 + n*2))
+	buf.WriteString("WAVEfmt ")
+	w(uint32(16))
+	w(uint16(1))                // PCM
+	w(uint16(channels))         // channels
+	w(uint32(16000))            // sample rate
+	w(uint32(32000 * channels)) // byte rate
+	w(uint16(2 * channels))     // block align
+	w(uint16(16))               // bits per sample
+	buf.WriteString("data")
+	w(uint32(n * 2))
+	w(samples)
+	return buf.Bytes()
+}
+
+// newTranscriptionRequest builds a multipart transcription request.
+func newTranscriptionRequest(t *testing.T, fields map[string]string) *http.Request {
+	t.Helper()
+	return newUploadRequest(t, testWAV(), fields)
+}
+
+// newUploadRequest builds a multipart transcription request for audio.
+func newUploadRequest(t *testing.T, audio []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(audio)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+var fakeSegments = []whisper.Segment{
+	{Start: 0, End: 150, Text: " Hello"},
+	{Start: 150, End: 300, Text: " world"},
+}
+
+func TestTranscriptionFormats(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `{"text":" Hello world"}`},
+		{"text", " Hello world"},
+		{"srt", "1\n00:00:00,000 --> 00:00:01,500\nHello\n"},
+		{"vtt", "WEBVTT\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"response_format": tt.format}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.format, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: body = %q, want it to contain %q", tt.format, w.Body, tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"response_format": "verbose_json"}))
+	var v verboseJSON
+	if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+		t.Fatalf("verbose_json: %v", err)
+	}
+	if len(v.Segments) != 2 || v.Segments[1].End != 3 || v.Usage == nil || v.Usage.AudioDuration != 1 {
+		t.Errorf("verbose_json = %+v", v)
+	}
+	if got := w.Header().Get("X-Sona-Audio-Duration"); got != "1.000" {
+		t.Errorf("X-Sona-Audio-Duration = %q, want 1.000", got)
+	}
+}
+
+func TestTranscriptionStreaming(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"stream": "true"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var types []string
+	var last map[string]any
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		var event map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+			t.Fatalf("bad event %q: %v", sc.Text(), err)
+		}
+		types = append(types, event["type"].(string))
+		last = event
+	}
+	want := []string{"segment", "progress", "segment", "progress", "result"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	if last["text"] != " Hello world" {
+		t.Errorf("result text = %v", last["text"])
+	}
+}
+
+func TestTranscriptionStreamingError(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments[:1], err: errors.New("decoder exploded")})
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"stream": "true"}))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	var event map[string]any
+	json.Unmarshal([]byte(lines[len(lines)-1]), &event)
+	if event["type"] != "error" || event["message"] != "decoder exploded" {
+		t.Errorf("last event = %v, want error event", event)
+	}
+}
+
+func TestTranscriptionError(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{err: errors.New("decoder exploded")})
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), ErrCodeInternalError) {
+		t.Errorf("body = %s, want %s", w.Body, ErrCodeInternalError)
+	}
+}
+
+func TestTranscriptionBusy(t *testing.T) {
+	model := &fakeTranscriber{
+		segments: fakeSegments,
+		started:  make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	s := newFakeServer(t, model)
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		s.handleTranscription(first, newTranscriptionRequest(t, nil))
+		close(done)
+	}()
+	<-model.started
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("concurrent request: expected 429, got %d", w.Code)
+	}
+
+	close(model.release)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Errorf("first request: expected 200, got %d", first.Code)
+	}
+}
+
+func TestTranscriptionAbortOnDisconnect(t *testing.T) {
+	model := &fakeTranscriber{
+		segments: fakeSegments,
+		started:  make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+	s := newFakeServer(t, model)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := newTranscriptionRequest(t, map[string]string{"stream": "true"}).WithContext(ctx)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		s.handleTranscription(w, req)
+		close(done)
+	}()
+	<-model.started
+	cancel()
+	<-done
+
+	model.mu.Lock()
+	defer model.mu.Unlock()
+	if !model.aborted {
+		t.Error("transcription was not aborted after client disconnect")
+	}
+	if strings.Contains(w.Body.String(), `"type":"error"`) {
+		t.Errorf("error event written to disconnected client: %s", w.Body)
+	}
+}
+
+func TestTranscriptionSessionContext(t *testing.T) {
+	model := &fakeTranscriber{segments: fakeSegments}
+	s := newFakeServer(t, model)
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"session_id": "dictation"}))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	}
+	if got := model.calls[0].PromptTokens; got != nil {
+		t.Errorf("first request prompt tokens = %v, want nil", got)
+	}
+	if got := model.calls[1].PromptTokens; len(got) != 2 {
+		t.Errorf("second request prompt tokens = %v, want the 2 tokens of the first result", got)
+	}
+}
+
+func TestModelLoadUsesEngine(t *testing.T) {
+	model := &fakeTranscriber{}
+	s := newFakeServer(t, model)
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	w := httptest.NewRecorder()
+	s.handleModels(w, req)
+	var body struct {
+		Data []map[string]any `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if len(body.Data) != 1 || body.Data[0]["id"] != "fake.bin" {
+		t.Errorf("models = %v, want fake.bin", body.Data)
+	}
+
+	s.UnloadModel()
+	if !model.closed {
+		t.Error("UnloadModel() did not close the transcriber")
+	}
+}
+
+func TestModelHashInBackground(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.bin")
+	if err := os.WriteFile(path, []byte("model"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewWithEngine(&fakeEngine{model: &fakeTranscriber{}}, false)
+	if err := s.LoadModel(path, whisper.ContextOptions{GPUDevice: -1}); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("model")))
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		w := httptest.NewRecorder()
+		s.handleModels(w, httptest.NewRequest("GET", "/v1/models", nil))
+		var body struct {
+			Data []struct {
+				SHA256 *string `json:"sha256"`
+			} `json:"data"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		if len(body.Data) != 1 {
+			t.Fatalf("models = %s", w.Body)
+		}
+		if got := body.Data[0].SHA256; got != nil {
+			if *got != sum {
+				t.Errorf("sha256 = %s, want %s", *got, sum)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sha256 still null after 5s")
+		}
+	}
+}
+
+func TestModelLoadFlashAttn(t *testing.T) {
+	model := &fakeTranscriber{}
+	s := newFakeServer(t, model)
+
+	w := httptest.NewRecorder()
+	s.handleModelLoad(w, httptest.NewRequest("POST", "/v1/models/load", strings.NewReader(`{"path":"fake.bin","flash_attn":true}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if !model.opts.FlashAttn {
+		t.Errorf("context options = %+v, want FlashAttn", model.opts)
+	}
+}
+
+func TestTranscriptionDecodingOptions(t *testing.T) {
+	model := &fakeTranscriber{segments: fakeSegments}
+	s := newFakeServer(t, model)
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"audio_ctx": "768", "single_segment": "true"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if opts := model.calls[0]; opts.AudioCtx != 768 || !opts.SingleSegment {
+		t.Errorf("options = %+v, want AudioCtx 768 and SingleSegment", opts)
+	}
+
+	for _, v := range []string{"-1", "1501", "small"} {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"audio_ctx": v}))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "audio_ctx") {
+			t.Errorf("audio_ctx=%s: expected 400, got %d: %s", v, w.Code, w.Body)
+		}
+	}
+}
+
+func TestTranscriptionOffsetDuration(t *testing.T) {
+	model := &fakeTranscriber{segments: fakeSegments}
+	s := newFakeServer(t, model)
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{
+		"offset":          "0.25",
+		"duration":        "0.5",
+		"response_format": "verbose_json",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if model.lengths[0] != audio.SampleRate/2 || model.calls[0].TimeOffset != 0.25 {
+		t.Errorf("transcribed %d samples with time offset %v, want %d from 0.25s", model.lengths[0], model.calls[0].TimeOffset, audio.SampleRate/2)
+	}
+	var v verboseJSON
+	json.NewDecoder(w.Body).Decode(&v)
+	if len(v.Segments) != 2 || v.Segments[0].Start != 0.25 || v.Segments[1].End != 3.25 {
+		t.Errorf("segments = %+v, want times from the start of the file", v.Segments)
+	}
+
+	for _, fields := range []map[string]string{{"offset": "-1"}, {"duration": "-0.5"}} {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, fields))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", fields, w.Code)
+		}
+	}
+}
+
+func TestTranscriptionChunked(t *testing.T) {
+	model := &fakeTranscriber{segments: fakeSegments[:1]}
+	s := newFakeServer(t, model)
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{
+		"chunk_length":    "0.4",
+		"response_format": "verbose_json",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if len(model.calls) != 3 {
+		t.Fatalf("transcribed %d chunks, want 3", len(model.calls))
+	}
+	if model.calls[0].TimeOffset != 0 || model.calls[1].TimeOffset <= 0.3 || model.calls[2].TimeOffset <= model.calls[1].TimeOffset {
+		t.Errorf("chunk time offsets = %v, %v, %v", model.calls[0].TimeOffset, model.calls[1].TimeOffset, model.calls[2].TimeOffset)
+	}
+	if len(model.calls[1].PromptTokens) == 0 {
+		t.Error("second chunk decoded without the first chunk's text as prompt")
+	}
+	var v verboseJSON
+	json.NewDecoder(w.Body).Decode(&v)
+	if len(v.Segments) != 3 || v.Usage == nil || v.Usage.AudioDuration != 1 {
+		t.Errorf("verbose_json = %+v, usage %+v", v, v.Usage)
+	}
+}
+
+func TestTranscriptionSplitChannels(t *testing.T) {
+	model := &fakeTranscriber{segments: fakeSegments}
+	s := newFakeServer(t, model)
+
+	// The right channel carries a quiet tone so it is not dropped as a copy.
+	samples := make([]int16, 2*16000)
+	for i := 1; i < len(samples); i += 4 {
+		samples[i] = 100
+	}
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newUploadRequest(t, pcmWAV(samples, 2), map[string]string{
+		"channels":        "split",
+		"response_format": "verbose_json",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if len(model.calls) != 2 {
+		t.Fatalf("transcribed %d channels, want 2", len(model.calls))
+	}
+	var v verboseJSON
+	json.NewDecoder(w.Body).Decode(&v)
+	if len(v.Segments) != 4 {
+		t.Fatalf("verbose_json segments = %+v, want 4", v.Segments)
+	}
+	for i, want := range []int{1, 2, 1, 2} {
+		seg := v.Segments[i]
+		if seg.Channel != want || seg.Speaker == nil || *seg.Speaker != want-1 {
+			t.Errorf("segment %d = %+v, want channel %d", i, seg, want)
+		}
+	}
+
+	// Channel 2 duplicates channel 1 and is dropped; channel 3 keeps its label.
+	model.calls = nil
+	samples = make([]int16, 3*16000)
+	for i := 2; i < len(samples); i += 6 {
+		samples[i] = 100
+	}
+	w = httptest.NewRecorder()
+	s.handleTranscription(w, newUploadRequest(t, pcmWAV(samples, 3), map[string]string{
+		"channels":        "split",
+		"response_format": "verbose_json",
+	}))
+	v = verboseJSON{}
+	json.NewDecoder(w.Body).Decode(&v)
+	if len(model.calls) != 2 || len(v.Segments) != 4 || v.Segments[0].Channel != 1 || v.Segments[1].Channel != 3 {
+		t.Errorf("3 channels with a copy: %d calls, segments %+v, want channels 1 and 3", len(model.calls), v.Segments)
+	}
+
+	for _, fields := range []map[string]string{
+		{"channels": "left"},
+		{"channels": "split", "chunk_length": "10"},
+		{"channels": "split", "diarize_model": "seg.onnx"},
+	} {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, fields))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", fields, w.Code)
+		}
+	}
+}
+
+func TestTranscriptionEnhanceAudioRemapsTimes(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+
+	// testWAV is 1s of silence, cut to 0.2s: 0.8s is removed after 0.1s.
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{
+		"enhance_audio":   "true",
+		"response_format": "verbose_json",
+	}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var v verboseJSON
+	json.NewDecoder(w.Body).Decode(&v)
+	if len(v.Segments) != 2 || v.Segments[0].Start != 0 || v.Segments[0].End != 2.3 || v.Segments[1].End != 3.8 {
+		t.Errorf("segments = %+v, want times on the original timeline", v.Segments)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"enhance_audio": "true", "stream": "true"}))
+	var event map[string]any
+	json.NewDecoder(w.Body).Decode(&event)
+	if event["type"] != "segment" || event["end"] != 2.3 {
+		t.Errorf("first event = %v, want a segment ending at 2.3", event)
+	}
+}
+
+func TestTranscriptionAudioFilters(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"audio_filters": "highpass=f=80,gain=3"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	for _, fields := range []map[string]string{
+		{"audio_filters": "reverb"},
+		{"audio_filters": "normalize", "chunk_length": "10"},
+	} {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, fields))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", fields, w.Code)
+		}
+	}
+}
+
+func TestTranscriptionAudioStreamValidation(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+	for _, v := range []string{"-1", "first"} {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"audio_stream": v}))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("audio_stream=%s: expected 400, got %d", v, w.Code)
+		}
+	}
+}
+
+func TestTranscriptionFilePathJSON(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audio.wav")
+	if err := os.WriteFile(path, testWAV(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jsonRequest := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/audio/transcriptions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, req)
+		return w
+	}
+
+	body := `{"file_path": "` + filepath.ToSlash(path) + `", "response_format": "verbose_json", "audio_filters": ["gain=3"]}`
+	if w := jsonRequest(body); w.Code != http.StatusForbidden {
+		t.Fatalf("without --allow-path: expected 403, got %d: %s", w.Code, w.Body)
+	}
+
+	s.AllowedPaths = []string{dir}
+	w := jsonRequest(body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var v verboseJSON
+	json.NewDecoder(w.Body).Decode(&v)
+	if len(v.Segments) != 2 {
+		t.Errorf("segments = %+v, want 2", v.Segments)
+	}
+
+	if w := jsonRequest(`{"file_path": "/etc/passwd"}`); w.Code != http.StatusForbidden {
+		t.Errorf("outside the allowlist: expected 403, got %d", w.Code)
+	}
+	if w := jsonRequest(`{"file_path": "` + filepath.ToSlash(filepath.Join(dir, "missing.wav")) + `"}`); w.Code != http.StatusForbidden {
+		t.Errorf("missing file: expected 403, got %d", w.Code)
+	}
+	if w := jsonRequest(`{"file_path": "` + filepath.ToSlash(dir) + `"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("directory: expected 400, got %d", w.Code)
+	}
+	if w := jsonRequest(`{"file_path": {"nested": 1}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("object value: expected 400, got %d", w.Code)
+	}
+}
+
+func TestTranscriptionRawBody(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+	rawRequest := func(contentType, query string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/audio/transcriptions?"+query, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, req)
+		return w
+	}
+	// One second of silence as 8kHz stereo L16.
+	l16 := make([]byte, 8000*2*2)
+
+	for _, tt := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"audio/wav", testWAV()},
+		{"application/octet-stream", testWAV()},
+		{"audio/L16; rate=8000; channels=2", l16},
+	} {
+		w := rawRequest(tt.contentType, "response_format=verbose_json&audio_filters=gain=3", tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tt.contentType, w.Code, w.Body)
+		}
+		var v verboseJSON
+		json.NewDecoder(w.Body).Decode(&v)
+		if v.Usage == nil || v.Usage.AudioDuration != 1 || len(v.Segments) != 2 {
+			t.Errorf("%s: usage %+v, %d segments, want 1s of audio and 2", tt.contentType, v.Usage, len(v.Segments))
+		}
+	}
+
+	for _, query := range []string{"chunk_length=10", "channels=split", "audio_filters=afftdn"} {
+		if w := rawRequest("audio/L16;rate=8000", query, l16); w.Code != http.StatusBadRequest {
+			t.Errorf("raw PCM with %s: expected 400, got %d", query, w.Code)
+		}
+	}
+	if w := rawRequest("audio/L16;rate=0", "", l16); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid rate: expected 400, got %d", w.Code)
+	}
+}
+
+func TestTranscriptionStageTimeouts(t *testing.T) {
+	model := &fakeTranscriber{segments: fakeSegments, release: make(chan struct{})}
+	s := newFakeServer(t, model)
+	s.TranscribeTimeout = 20 * time.Millisecond
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, nil))
+	if w.Code != http.StatusGatewayTimeout || !strings.Contains(w.Body.String(), ErrCodeTimeout) {
+		t.Fatalf("expected 504 %s, got %d: %s", ErrCodeTimeout, w.Code, w.Body)
+	}
+	if !model.aborted {
+		t.Error("transcription was not aborted")
+	}
+
+	w = httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"stream": "true"}))
+	var event map[string]any
+	json.NewDecoder(w.Body).Decode(&event)
+	if event["type"] != "error" || !strings.Contains(event["message"].(string), "timed out") {
+		t.Errorf("stream event = %v, want a timeout error", event)
+	}
+
+	// Decoding checks its deadline between blocks.
+	s.DecodeTimeout = time.Nanosecond
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", bytes.NewReader(make([]byte, 32000)))
+	req.Header.Set("Content-Type", "audio/L16;rate=16000")
+	w = httptest.NewRecorder()
+	s.handleTranscription(w, req)
+	if w.Code != http.StatusGatewayTimeout || !strings.Contains(w.Body.String(), "audio decoding timed out") {
+		t.Errorf("expected 504 for decoding, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestTranscriptionAudioTooLong(t *testing.T) {
+	s := newFakeServer(t, &fakeTranscriber{segments: fakeSegments})
+	s.MaxAudioDuration = 500 * time.Millisecond
+
+	// Decoding stops one sample past the limit.
+	for _, fields := range []map[string]string{nil, {"chunk_length": "10"}} {
+		w := httptest.NewRecorder()
+		s.handleTranscription(w, newTranscriptionRequest(t, fields))
+		if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), ErrCodeAudioTooLong) ||
+			!strings.Contains(w.Body.String(), "at least 0.5s long (8001 samples)") {
+			t.Errorf("%v: expected 413 %s with the decoded length, got %d: %s", fields, ErrCodeAudioTooLong, w.Code, w.Body)
+		}
+	}
+
+	// Split channels count toward MaxSamples together.
+	s.MaxAudioDuration = 0
+	s.MaxSamples = 3 * audio.SampleRate
+	stereo := make([]int16, 4*audio.SampleRate)
+	for i := 0; i < len(stereo); i += 2 {
+		stereo[i] = 1000 // distinct channels
+	}
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newUploadRequest(t, pcmWAV(stereo, 2), map[string]string{"channels": "split"}))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("split: expected 413, got %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	s.handleTranscription(w, newUploadRequest(t, pcmWAV(stereo, 2), nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("mixed: expected 200, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestTranscriptionStableTimestampsWithoutVADModel(t *testing.T) {
+	model := &fakeTranscriber{segments: fakeSegments}
+	s := newFakeServer(t, model)
+
+	w := httptest.NewRecorder()
+	s.handleTranscription(w, newTranscriptionRequest(t, map[string]string{"stable_timestamps": "true"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if opts := model.calls[0]; !opts.StableTimestamps || opts.VadModelPath != "" {
+		t.Errorf("options = %+v, want stable timestamps with the built-in VAD", opts)
+	}
+}
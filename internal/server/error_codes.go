@@ -6,4 +6,7 @@ const (
 	ErrCodeBusy           = "busy"
 	ErrCodeNoModel        = "no_model"
 	ErrCodeInternalError  = "internal_error"
+	ErrCodePathNotAllowed = "path_not_allowed"
+	ErrCodeTimeout        = "timeout"
+	ErrCodeAudioTooLong   = "audio_too_long"
 )
@@ -1,6 +1,9 @@
 package server
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 func parseBoolFormValue(v string) bool {
 	b, err := strconv.ParseBool(v)
@@ -22,3 +25,25 @@ func parseFloatFormValue(v string) float32 {
 	}
 	return float32(f)
 }
+
+func parseFloat64FormValue(v string) float64 {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// parseListFormValue flattens repeated and comma-separated form values into
+// a list of trimmed, non-empty entries.
+func parseListFormValue(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
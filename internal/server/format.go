@@ -2,8 +2,10 @@ package server
 
 import (
 	"fmt"
+	"math"
 	"strings"
 
+	"github.com/thewh1teagle/sona/internal/audio"
 	"github.com/thewh1teagle/sona/internal/diarize"
 	"github.com/thewh1teagle/sona/internal/whisper"
 )
@@ -76,35 +78,74 @@ type verboseSegment struct {
 	Start   float64 `json:"start"`
 	End     float64 `json:"end"`
 	Text    string  `json:"text"`
+	Channel int     `json:"channel,omitempty"`
 	Speaker *int    `json:"speaker,omitempty"`
 }
 
+// verboseWord is the JSON representation of a word in verbose_json format.
+type verboseWord struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float32 `json:"probability"`
+}
+
 // verboseJSON is the response body for response_format=verbose_json.
 type verboseJSON struct {
 	Text     string           `json:"text"`
 	Segments []verboseSegment `json:"segments"`
+	Words    []verboseWord    `json:"words,omitempty"`
+	Usage    *usageJSON       `json:"usage,omitempty"`
+	Timings  *timingsJSON     `json:"timings,omitempty"`
 }
 
 // buildVerboseJSON creates the verbose_json response structure.
-// If diarSegments is non-nil, each transcription segment is assigned
-// the speaker with maximum time overlap.
+// Each segment is assigned a speaker by segmentSpeaker.
 func buildVerboseJSON(segments []whisper.Segment, diarSegments []diarize.Segment) verboseJSON {
 	text := whisper.TranscribeResult{Segments: segments}.Text()
 	vSegs := make([]verboseSegment, len(segments))
 	for i, seg := range segments {
 		vSegs[i] = verboseSegment{
-			Start: csToSeconds(seg.Start),
-			End:   csToSeconds(seg.End),
-			Text:  seg.Text,
+			Start:   csToSeconds(seg.Start),
+			End:     csToSeconds(seg.End),
+			Text:    seg.Text,
+			Channel: seg.Channel,
 		}
-		if diarSegments != nil {
-			if sp := matchSpeaker(csToSeconds(seg.Start), csToSeconds(seg.End), diarSegments); sp >= 0 {
-				id := sp
-				vSegs[i].Speaker = &id
-			}
+		if sp := segmentSpeaker(seg, diarSegments); sp >= 0 {
+			vSegs[i].Speaker = &sp
+		}
+	}
+	return verboseJSON{Text: text, Segments: vSegs, Words: buildVerboseWords(segments)}
+}
+
+// buildVerboseWords flattens segment words into the OpenAI-style top-level
+// "words" list. It returns nil when no segment carries words.
+func buildVerboseWords(segments []whisper.Segment) []verboseWord {
+	var words []verboseWord
+	for _, seg := range segments {
+		for _, w := range seg.Words {
+			words = append(words, verboseWord{
+				Word:        w.Text,
+				Start:       csToSeconds(w.Start),
+				End:         csToSeconds(w.End),
+				Probability: w.Probability,
+			})
 		}
 	}
-	return verboseJSON{Text: text, Segments: vSegs}
+	return words
+}
+
+// segmentSpeaker returns the speaker of seg: its channel (0-based) when
+// channels were transcribed separately, otherwise the diarization speaker
+// with maximum time overlap. It returns -1 when neither is known.
+func segmentSpeaker(seg whisper.Segment, diarSegments []diarize.Segment) int {
+	if seg.Channel > 0 {
+		return seg.Channel - 1
+	}
+	if diarSegments == nil {
+		return -1
+	}
+	return matchSpeaker(csToSeconds(seg.Start), csToSeconds(seg.End), diarSegments)
 }
 
 // matchSpeaker finds the diarization segment with maximum overlap and
@@ -129,3 +170,55 @@ func matchSpeaker(start, end float64, diarSegments []diarize.Segment) int {
 	}
 	return bestID
 }
+
+// shiftDiarSegments moves diarization segments later by offset seconds, for
+// diarization that ran on a trimmed copy of the audio.
+func shiftDiarSegments(segments []diarize.Segment, offset float64) []diarize.Segment {
+	for i := range segments {
+		segments[i].Start += offset
+		segments[i].End += offset
+	}
+	return segments
+}
+
+// remapTranscription wraps transcribe so that segments, streamed and final,
+// are moved from silence-trimmed time back to the original timeline.
+// timeMap is called per segment, since a Stream only knows the cuts in the
+// audio read so far; offset is where the trimmed audio starts.
+func remapTranscription(transcribe func(whisper.TranscribeOptions, whisper.StreamCallbacks) (whisper.TranscribeResult, error), timeMap func() audio.TimeMap, offset float64) func(whisper.TranscribeOptions, whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+	return func(opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+		if onSegment := cb.OnSegment; onSegment != nil {
+			cb.OnSegment = func(seg whisper.Segment) {
+				onSegment(remapSegment(seg, timeMap(), offset))
+			}
+		}
+		result, err := transcribe(opts, cb)
+		tm := timeMap()
+		for i, seg := range result.Segments {
+			result.Segments[i] = remapSegment(seg, tm, offset)
+		}
+		return result, err
+	}
+}
+
+// remapSegment maps the times of seg, which count from offset in the
+// trimmed audio, through timeMap.
+func remapSegment(seg whisper.Segment, timeMap audio.TimeMap, offset float64) whisper.Segment {
+	remap := func(cs int64, original func(float64) float64) int64 {
+		return int64(math.Round((offset + original(csToSeconds(cs)-offset)) * 100))
+	}
+	// An empty span on a cut would otherwise start after it ends.
+	start, end := timeMap.Original, timeMap.OriginalEnd
+	seg.Start, seg.End = remap(seg.Start, start), remap(seg.End, end)
+	seg.End = max(seg.End, seg.Start)
+	if seg.Words != nil {
+		words := make([]whisper.Word, len(seg.Words))
+		for i, w := range seg.Words {
+			w.Start, w.End = remap(w.Start, start), remap(w.End, end)
+			w.End = max(w.End, w.Start)
+			words[i] = w
+		}
+		seg.Words = words
+	}
+	return seg
+}
@@ -3,6 +3,8 @@ package server
 import (
 	"testing"
 
+	"github.com/thewh1teagle/sona/internal/audio"
+	"github.com/thewh1teagle/sona/internal/diarize"
 	"github.com/thewh1teagle/sona/internal/whisper"
 )
 
@@ -99,6 +101,28 @@ func TestBuildVerboseJSON(t *testing.T) {
 	}
 }
 
+func TestBuildVerboseJSONWords(t *testing.T) {
+	segments := []whisper.Segment{
+		{Start: 0, End: 100, Text: " Hi there", Words: []whisper.Word{
+			{Start: 0, End: 40, Text: "Hi", Probability: 0.9},
+			{Start: 40, End: 100, Text: "there", Probability: 0.8},
+		}},
+		{Start: 100, End: 150, Text: " again", Words: []whisper.Word{
+			{Start: 100, End: 150, Text: "again", Probability: 0.7},
+		}},
+	}
+	v := buildVerboseJSON(segments, nil)
+	if len(v.Words) != 3 {
+		t.Fatalf("got %d words, want 3", len(v.Words))
+	}
+	if w := v.Words[2]; w.Word != "again" || w.Start != 1.0 || w.End != 1.5 {
+		t.Errorf("words[2] = %+v, want again 1.0-1.5", w)
+	}
+	if v := buildVerboseJSON([]whisper.Segment{{Start: 0, End: 100, Text: "Hi"}}, nil); v.Words != nil {
+		t.Errorf("Words = %v, want nil without word timestamps", v.Words)
+	}
+}
+
 func TestParseBoolFormValue(t *testing.T) {
 	tests := []struct {
 		input string
@@ -118,3 +142,47 @@ func TestParseBoolFormValue(t *testing.T) {
 		}
 	}
 }
+
+func TestParseListFormValue(t *testing.T) {
+	got := parseListFormValue([]string{"Sona, whisper.cpp", " ggml ", ",,"})
+	want := []string{"Sona", "whisper.cpp", "ggml"}
+	if len(got) != len(want) {
+		t.Fatalf("parseListFormValue() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("item[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestShiftDiarSegments(t *testing.T) {
+	// Diarization of audio trimmed to start at 10s reports times from 0.
+	diar := shiftDiarSegments([]diarize.Segment{
+		{Start: 0, End: 2, SpeakerID: 0},
+		{Start: 2, End: 4, SpeakerID: 1},
+	}, 10)
+	if diar[0].Start != 10 || diar[0].End != 12 || diar[1].Start != 12 || diar[1].End != 14 {
+		t.Fatalf("shifted = %+v, want times from 10s", diar)
+	}
+	// Whisper segments with the same offset then pick the right speakers.
+	v := buildVerboseJSON([]whisper.Segment{{Start: 1000, End: 1150}, {Start: 1250, End: 1400}}, diar)
+	if v.Segments[0].Speaker == nil || *v.Segments[0].Speaker != 0 || v.Segments[1].Speaker == nil || *v.Segments[1].Speaker != 1 {
+		t.Errorf("segments = %+v, want speakers 0 then 1", v.Segments)
+	}
+}
+
+func TestRemapSegmentAtCut(t *testing.T) {
+	// 2s of pause were removed at 1s of the trimmed audio.
+	tm := audio.TimeMap{{At: audio.SampleRate, Removed: 2 * audio.SampleRate}}
+	seg := remapSegment(whisper.Segment{
+		Start: 50, End: 100,
+		Words: []whisper.Word{{Start: 50, End: 100}},
+	}, tm, 0)
+	if seg.Start != 50 || seg.End != 100 || seg.Words[0].End != 100 {
+		t.Errorf("segment ending at the cut = %+v, want it to end at 1s", seg)
+	}
+	if seg := remapSegment(whisper.Segment{Start: 100, End: 150}, tm, 0); seg.Start != 300 || seg.End != 350 {
+		t.Errorf("segment starting at the cut = %+v, want 3s to 3.5s", seg)
+	}
+}
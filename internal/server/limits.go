@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+)
+
+// audioTooLongError rejects decoded audio over MaxAudioDuration or
+// MaxSamples.
+type audioTooLongError struct {
+	seconds float64
+	samples int64
+	partial bool // decoding stopped early, so the audio is at least this long
+	limit   string
+}
+
+func (e *audioTooLongError) Error() string {
+	atLeast := ""
+	if e.partial {
+		atLeast = "at least "
+	}
+	return fmt.Sprintf("audio is %s%.1fs long (%d samples), over the limit of %s", atLeast, e.seconds, e.samples, e.limit)
+}
+
+// checkAudioLength returns an *audioTooLongError if samples 16kHz samples,
+// counted over all channels, spanning seconds of audio exceed the server's
+// limits.
+func (s *Server) checkAudioLength(seconds float64, samples int64, partial bool) error {
+	switch {
+	case s.MaxAudioDuration > 0 && seconds > s.MaxAudioDuration.Seconds():
+		return &audioTooLongError{seconds, samples, partial, s.MaxAudioDuration.String()}
+	case s.MaxSamples > 0 && samples > s.MaxSamples:
+		return &audioTooLongError{seconds, samples, partial, fmt.Sprintf("%d samples", s.MaxSamples)}
+	}
+	return nil
+}
+
+// limitDuration returns the duration to decode for a requested duration (0
+// for the rest of the audio): at most one sample past the server's limits,
+// so over-long audio is caught without decoding all of it.
+func (s *Server) limitDuration(duration float64) float64 {
+	limit := int64(-1) // mono samples
+	if s.MaxAudioDuration > 0 {
+		limit = int64(s.MaxAudioDuration.Seconds() * audio.SampleRate)
+	}
+	if s.MaxSamples > 0 && (limit < 0 || s.MaxSamples < limit) {
+		limit = s.MaxSamples
+	}
+	if limit < 0 {
+		return duration
+	}
+	// The extra half sample keeps float rounding from losing the one past
+	// the limit.
+	capped := (float64(limit) + 1.5) / audio.SampleRate
+	if duration > 0 && duration < capped {
+		return duration
+	}
+	return capped
+}
+
+func writeAudioTooLong(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusRequestEntityTooLarge, ErrCodeAudioTooLong, err.Error())
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/ggml"
+)
+
+// hashKey identifies a version of a model file.
+type hashKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// modelHashes computes model file SHA-256s in the background, so hashing a
+// multi-gigabyte model neither slows loading nor holds the server mutex.
+// Sums are cached by path, size and mtime.
+type modelHashes struct {
+	mu   sync.Mutex
+	sums map[hashKey]string
+	busy map[hashKey]bool
+}
+
+// get returns the sum for key, or "" while it is still being computed, in
+// which case hashing is started if it is not already running.
+func (h *modelHashes) get(key hashKey) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if sum, ok := h.sums[key]; ok {
+		return sum
+	}
+	if h.busy[key] {
+		return ""
+	}
+	if h.busy == nil {
+		h.busy = make(map[hashKey]bool)
+		h.sums = make(map[hashKey]string)
+	}
+	h.busy[key] = true
+	go func() {
+		sum, err := ggml.FileSHA256(key.path)
+		if err != nil {
+			log.Printf("failed to hash model file: %v", err)
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.busy, key)
+		if err == nil {
+			h.sums[key] = sum
+		}
+	}()
+	return ""
+}
@@ -14,60 +14,124 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/thewh1teagle/sona/internal/ggml"
 	"github.com/thewh1teagle/sona/internal/whisper"
 )
 
 const maxUploadSize = 15 << 30 // 15 GB
 
+// modelMeta describes the loaded model file, reported by /v1/models.
+type modelMeta struct {
+	Size     int64
+	ModTime  time.Time
+	LoadedAt time.Time
+	LoadTime time.Duration
+	Info     ggml.ModelInfo
+}
+
 type Server struct {
 	mu        sync.Mutex
-	ctx       *whisper.Context // nil when no model loaded
+	engine    Engine
+	ctx       Transcriber // nil when no model loaded
 	modelName string
 	modelPath string
+	model     modelMeta
 	verbose   bool
+	sessions  sessionStore
+	hashes    modelHashes
 	Version   string
 	Commit    string
+
+	// SessionTokens is how many output tokens a session_id keeps as context.
+	SessionTokens int
+	// SessionTTL is how long an idle session is kept.
+	SessionTTL time.Duration
+	// AllowedPaths are the directories whose files requests may name with
+	// file_path. Empty disables file_path.
+	AllowedPaths []string
+	// DecodeTimeout, DiarizeTimeout and TranscribeTimeout bound the stages
+	// of a transcription request; zero means no limit. With chunk_length,
+	// decoding happens during transcription and counts toward the latter.
+	DecodeTimeout     time.Duration
+	DiarizeTimeout    time.Duration
+	TranscribeTimeout time.Duration
+	// MaxAudioDuration and MaxSamples reject requests whose decoded audio
+	// is longer, before inference; zero means no limit. MaxSamples counts
+	// 16kHz samples over all channels.
+	MaxAudioDuration time.Duration
+	MaxSamples       int64
 }
 
 func New(verbose bool) *Server {
-	return &Server{verbose: verbose}
+	return NewWithEngine(WhisperEngine{}, verbose)
+}
+
+// NewWithEngine creates a server that loads models with engine.
+func NewWithEngine(engine Engine, verbose bool) *Server {
+	return &Server{
+		engine:        engine,
+		verbose:       verbose,
+		SessionTokens: defaultSessionTokens,
+		SessionTTL:    defaultSessionTTL,
+	}
 }
 
 // LoadModel loads a whisper model, unloading any existing one first.
-// gpuDevice selects the GPU (-1 = use whisper default).
-func (s *Server) LoadModel(path string, gpuDevice int, noGpu bool) error {
+// opts.GPUDevice selects the GPU (-1 = use whisper default).
+func (s *Server) LoadModel(path string, opts whisper.ContextOptions) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.loadModelLocked(path, gpuDevice, noGpu)
+	return s.loadModelLocked(path, opts)
 }
 
-func (s *Server) loadModelLocked(path string, gpuDevice int, noGpu bool) error {
+func (s *Server) loadModelLocked(path string, opts whisper.ContextOptions) error {
+	// Session tokens belong to the old model's vocabulary.
+	s.sessions.clear()
 	if s.ctx != nil {
 		s.ctx.Close()
 		s.ctx = nil
 		s.modelName = ""
 		s.modelPath = ""
+		s.model = modelMeta{}
 	}
 
-	ctx, err := whisper.New(path, gpuDevice, noGpu)
+	start := time.Now()
+	ctx, err := s.engine.Load(path, opts)
 	if err != nil {
 		return err
 	}
 	s.ctx = ctx
 	s.modelPath = path
 	s.modelName = filepath.Base(path)
+	s.model = modelMeta{
+		LoadedAt: time.Now(),
+		LoadTime: time.Since(start),
+		Info:     ctx.ModelInfo(),
+	}
+	if st, err := os.Stat(path); err == nil {
+		s.model.Size = st.Size()
+		s.model.ModTime = st.ModTime()
+		s.hashes.get(s.modelHash())
+	}
 	return nil
 }
 
+// modelHash is the hashes key of the loaded model file.
+func (s *Server) modelHash() hashKey {
+	return hashKey{s.modelPath, s.model.Size, s.model.ModTime}
+}
+
 // UnloadModel frees the current model. Safe to call with no model loaded.
 func (s *Server) UnloadModel() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.sessions.clear()
 	if s.ctx != nil {
 		s.ctx.Close()
 		s.ctx = nil
 		s.modelName = ""
 		s.modelPath = ""
+		s.model = modelMeta{}
 	}
 }
 
@@ -95,7 +159,9 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("POST /v1/models/load", s.handleModelLoad)
 	mux.HandleFunc("DELETE /v1/models", s.handleModelUnload)
 	mux.HandleFunc("POST /v1/audio/transcriptions", s.handleTranscription)
+	mux.HandleFunc("POST /v1/audio/probe", s.handleProbe)
 	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("DELETE /v1/sessions/{id}", s.handleSessionReset)
 	s.registerDocsRoutes(mux)
 	return recoveryMiddleware(mux)
 }
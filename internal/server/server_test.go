@@ -2,9 +2,14 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestHealthEndpoint(t *testing.T) {
@@ -67,6 +72,17 @@ func TestTranscriptionNoModel(t *testing.T) {
 	}
 }
 
+func TestProbeMissingFile(t *testing.T) {
+	s := New(false)
+	req := httptest.NewRequest("POST", "/v1/audio/probe", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
 func TestModelUnloadIdempotent(t *testing.T) {
 	s := New(false)
 	req := httptest.NewRequest("DELETE", "/v1/models", nil)
@@ -82,3 +98,129 @@ func TestModelUnloadIdempotent(t *testing.T) {
 		t.Errorf("expected status unloaded, got %q", body["status"])
 	}
 }
+
+func TestRequestStatsHeaders(t *testing.T) {
+	st := &requestStats{
+		audioDuration: 10,
+		total:         2 * time.Second,
+		audioDecode:   250 * time.Millisecond,
+		gpu:           true,
+	}
+	w := httptest.NewRecorder()
+	st.setHeaders(w.Header())
+
+	want := map[string]string{
+		"X-Sona-Audio-Duration":   "10.000",
+		"X-Sona-Real-Time-Factor": "0.200",
+		"X-Sona-GPU":              "true",
+		"X-Sona-Audio-Decode-Ms":  "250.000",
+		"X-Sona-Total-Ms":         "2000.000",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	if got := w.Header().Get("X-Sona-Diarize-Ms"); got != "" {
+		t.Errorf("X-Sona-Diarize-Ms = %q, want unset without diarization", got)
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	var st sessionStore
+	now := time.Now()
+
+	st.append("a", []int32{1, 2, 3}, 4, time.Minute, now)
+	st.append("a", []int32{4, 5}, 4, time.Minute, now)
+	got := st.get("a", time.Minute, now)
+	if want := []int32{2, 3, 4, 5}; !slices.Equal(got, want) {
+		t.Errorf("tokens = %v, want %v", got, want)
+	}
+	if got := st.get("b", time.Minute, now); got != nil {
+		t.Errorf("unknown session tokens = %v, want nil", got)
+	}
+
+	// Idle past the TTL: the session expires.
+	if got := st.get("a", time.Minute, now.Add(2*time.Minute)); got != nil {
+		t.Errorf("expired session tokens = %v, want nil", got)
+	}
+
+	st.append("c", []int32{7}, 4, time.Minute, now)
+	if !st.reset("c") || st.get("c", time.Minute, now) != nil {
+		t.Error("reset did not forget session")
+	}
+}
+
+func TestSessionResetEndpoint(t *testing.T) {
+	s := New(false)
+	s.sessions.append("dictation-1", []int32{1}, s.SessionTokens, s.SessionTTL, time.Now())
+
+	req := httptest.NewRequest("DELETE", "/v1/sessions/dictation-1", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if got := s.sessions.get("dictation-1", s.SessionTTL, time.Now()); got != nil {
+		t.Errorf("session tokens after reset = %v, want nil", got)
+	}
+}
+
+func TestAllowedPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	inside := filepath.Join(root, "a.wav")
+	secret := filepath.Join(outside, "secret.wav")
+	os.WriteFile(inside, nil, 0o644)
+	os.WriteFile(secret, nil, 0o644)
+	link := filepath.Join(root, "link.wav")
+	if err := os.Symlink(secret, link); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+
+	for _, p := range []string{inside, "file://" + filepath.ToSlash(inside)} {
+		if _, err := allowedPath(p, []string{root}); err != nil {
+			t.Errorf("allowedPath(%q) = %v, want allowed", p, err)
+		}
+	}
+	for _, p := range []string{secret, link, filepath.Join(root, "..", filepath.Base(outside), "secret.wav")} {
+		if _, err := allowedPath(p, []string{root}); !errors.Is(err, errPathNotAllowed) {
+			t.Errorf("allowedPath(%q) = %v, want errPathNotAllowed", p, err)
+		}
+	}
+	if _, err := allowedPath(inside, nil); !errors.Is(err, errPathNotAllowed) {
+		t.Errorf("allowedPath with no roots = %v, want errPathNotAllowed", err)
+	}
+	// Missing files, relative paths and bad URLs fail the same way, inside a
+	// root or not.
+	for _, p := range []string{filepath.Join(root, "missing.wav"), filepath.Join(outside, "missing.wav"), "a.wav", "file://host/a.wav"} {
+		if _, err := allowedPath(p, []string{root}); !errors.Is(err, errPathNotAllowed) {
+			t.Errorf("allowedPath(%q) = %v, want errPathNotAllowed", p, err)
+		}
+	}
+	// A relative root, as in --allow-path ./media, is taken from the
+	// working directory.
+	t.Chdir(filepath.Dir(root))
+	if _, err := allowedPath(inside, []string{"." + string(filepath.Separator) + filepath.Base(root)}); err != nil {
+		t.Errorf("allowedPath with a relative root = %v, want allowed", err)
+	}
+}
+
+func TestLimitDuration(t *testing.T) {
+	s := &Server{}
+	if got := s.limitDuration(5); got != 5 {
+		t.Errorf("without limits: limitDuration(5) = %v, want 5", got)
+	}
+	s.MaxAudioDuration = 2 * time.Second
+	s.MaxSamples = 16000
+	for _, tt := range []struct{ duration, want float64 }{
+		{0, 16001.5 / 16000},
+		{10, 16001.5 / 16000},
+		{0.5, 0.5},
+	} {
+		if got := s.limitDuration(tt.duration); got != tt.want {
+			t.Errorf("limitDuration(%v) = %v, want %v", tt.duration, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSessionTokens is half of whisper's 448-token text context, the
+	// most whisper.cpp keeps from a prompt.
+	defaultSessionTokens = 224
+	defaultSessionTTL    = 10 * time.Minute
+)
+
+// sessionStore keeps the tail of each dictation session's output tokens so
+// the next request can decode with them as context. It has its own lock so
+// sessions can be reset while a transcription holds the server mutex.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+type session struct {
+	tokens   []int32
+	lastUsed time.Time
+}
+
+// get returns a copy of the session's tokens, or nil for unknown or expired
+// sessions.
+func (st *sessionStore) get(id string, ttl time.Duration, now time.Time) []int32 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expireLocked(ttl, now)
+	sess, ok := st.sessions[id]
+	if !ok {
+		return nil
+	}
+	sess.lastUsed = now
+	return append([]int32(nil), sess.tokens...)
+}
+
+// append adds tokens to a session, keeping only the last maxTokens.
+func (st *sessionStore) append(id string, tokens []int32, maxTokens int, ttl time.Duration, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.expireLocked(ttl, now)
+	if st.sessions == nil {
+		st.sessions = make(map[string]*session)
+	}
+	sess, ok := st.sessions[id]
+	if !ok {
+		sess = &session{}
+		st.sessions[id] = sess
+	}
+	sess.tokens = append(sess.tokens, tokens...)
+	if len(sess.tokens) > maxTokens {
+		sess.tokens = append([]int32(nil), sess.tokens[len(sess.tokens)-maxTokens:]...)
+	}
+	sess.lastUsed = now
+}
+
+// reset forgets one session. It reports whether the session existed.
+func (st *sessionStore) reset(id string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, ok := st.sessions[id]
+	delete(st.sessions, id)
+	return ok
+}
+
+// clear forgets all sessions, e.g. when the model (and its vocabulary) changes.
+func (st *sessionStore) clear() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.sessions = nil
+}
+
+func (st *sessionStore) expireLocked(ttl time.Duration, now time.Time) {
+	for id, sess := range st.sessions {
+		if now.Sub(sess.lastUsed) > ttl {
+			delete(st.sessions, id)
+		}
+	}
+}
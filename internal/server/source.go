@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxJSONBodySize bounds a JSON request body, which carries only options.
+const maxJSONBodySize = 1 << 20
+
+// errPathNotAllowed is returned for a file_path outside AllowedPaths.
+var errPathNotAllowed = errors.New("file_path is not under an allowed directory")
+
+// requestFile returns the audio of a request: the uploaded "file", the file
+// named by "file_path" read in place, or a raw audio body. A JSON body is
+// accepted instead of a multipart form; its fields become form values. With
+// a raw body the options come from the query string. cleanup closes the
+// file and removes any temp copy.
+func (s *Server) requestFile(r *http.Request) (file multipart.File, cleanup func(), err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json":
+		if err := parseJSONForm(r); err != nil {
+			return nil, nil, err
+		}
+	case isRawAudio(mediaType):
+		r.ParseForm()
+		return spillBody(r.Body)
+	}
+	if p := r.FormValue("file_path"); p != "" {
+		path, err := allowedPath(p, s.AllowedPaths)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Opening a FIFO would block until something writes to it, so check
+		// before opening and again on what was opened.
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return nil, nil, fmt.Errorf("file_path is not a regular file: %s", p)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+			f.Close()
+			return nil, nil, fmt.Errorf("file_path is not a regular file: %s", p)
+		}
+		return f, func() { f.Close() }, nil
+	}
+	file, _, err = r.FormFile("file")
+	if err != nil {
+		return nil, nil, fmt.Errorf("missing or invalid 'file' field: %w", err)
+	}
+	return file, func() { file.Close() }, nil
+}
+
+// isRawAudio reports whether a request body of mediaType is the audio itself.
+func isRawAudio(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "audio/") || mediaType == "application/octet-stream"
+}
+
+// spillBody copies a raw audio body to a temp file, which decoders and
+// ffmpeg can seek in.
+func spillBody(body io.Reader) (multipart.File, func(), error) {
+	tmp, err := os.CreateTemp("", "sona-*.audio")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if _, err := io.Copy(tmp, body); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return tmp, cleanup, nil
+}
+
+// writeRequestFileError reports a requestFile error.
+func writeRequestFileError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errPathNotAllowed) {
+		writeError(w, http.StatusForbidden, ErrCodePathNotAllowed, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+}
+
+// parseJSONForm decodes a flat JSON object body into r.Form, so handlers
+// read its fields with FormValue like multipart fields. Arrays become
+// repeated values.
+func parseJSONForm(r *http.Request) error {
+	var body map[string]any
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxJSONBodySize))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	form := url.Values{}
+	for key, v := range body {
+		values, ok := v.([]any)
+		if !ok {
+			values = []any{v}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case nil:
+			case string:
+				form.Add(key, v)
+			case json.Number, bool:
+				form.Add(key, fmt.Sprint(v))
+			default:
+				return fmt.Errorf("invalid JSON body: %q must be a string, number, boolean or array of them", key)
+			}
+		}
+	}
+	r.Form, r.PostForm = form, form
+	// Mark the body as parsed so FormFile does not try multipart.
+	r.MultipartForm = &multipart.Form{}
+	return nil
+}
+
+// allowedPath resolves a file_path, plain or a file:// URL, to a file under
+// one of roots. The path must lie under a root as written and again once
+// symlinks are resolved, so links cannot point outside. Every failure is
+// errPathNotAllowed, so callers learn nothing about files outside the roots.
+func allowedPath(p string, roots []string) (string, error) {
+	if len(roots) == 0 {
+		return "", fmt.Errorf("%w: file_path is disabled (start the server with --allow-path)", errPathNotAllowed)
+	}
+	notAllowed := fmt.Errorf("%w: %s", errPathNotAllowed, p)
+	if strings.HasPrefix(p, "file:") {
+		u, err := url.Parse(p)
+		if err != nil || (u.Host != "" && u.Host != "localhost") {
+			return "", notAllowed
+		}
+		p = u.Path
+		if len(p) > 2 && p[0] == '/' && p[2] == ':' { // file:///C:/... on Windows
+			p = p[1:]
+		}
+		p = filepath.FromSlash(p)
+	}
+	if !filepath.IsAbs(p) {
+		return "", notAllowed
+	}
+	p = filepath.Clean(p)
+
+	var absRoots, resolvedRoots []string
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		absRoots = append(absRoots, root)
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			resolvedRoots = append(resolvedRoots, resolved)
+		}
+	}
+	// Check the path as written before touching the filesystem, so probing
+	// outside the roots cannot tell what exists there.
+	if !underAny(p, absRoots) && !underAny(p, resolvedRoots) {
+		return "", notAllowed
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil || !underAny(resolved, resolvedRoots) {
+		return "", notAllowed
+	}
+	return resolved, nil
+}
+
+// underAny reports whether the clean absolute path p is one of roots or
+// inside one.
+func underAny(p string, roots []string) bool {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// requestStats collects wall-clock stage timings and whisper's own inference
+// timings for one transcription request.
+type requestStats struct {
+	start         time.Time
+	total         time.Duration
+	audioDuration float64 // seconds
+	gpu           bool
+	audioDecode   time.Duration
+	diarize       time.Duration
+	transcribe    time.Duration
+	whisper       whisper.Timings
+}
+
+// usageJSON is the "usage" object in verbose_json and streaming results.
+type usageJSON struct {
+	AudioDuration  float64 `json:"audio_duration"`
+	RealTimeFactor float64 `json:"real_time_factor"`
+	GPU            bool    `json:"gpu"`
+}
+
+// timingsJSON is the "timings" object in verbose_json and streaming results.
+// All values are in milliseconds. The *_avg_ms values are whisper.cpp's
+// mean time per call of each stage, omitted when it reports none (parallel
+// chunks).
+type timingsJSON struct {
+	AudioDecodeMs float64  `json:"audio_decode_ms"`
+	DiarizeMs     float64  `json:"diarize_ms,omitempty"`
+	TranscribeMs  float64  `json:"transcribe_ms"`
+	SampleAvgMs   *float64 `json:"sample_avg_ms,omitempty"`
+	EncodeAvgMs   *float64 `json:"encode_avg_ms,omitempty"`
+	DecodeAvgMs   *float64 `json:"decode_avg_ms,omitempty"`
+	BatchdAvgMs   *float64 `json:"batchd_avg_ms,omitempty"`
+	PromptAvgMs   *float64 `json:"prompt_avg_ms,omitempty"`
+	TotalMs       float64  `json:"total_ms"`
+}
+
+func newRequestStats() *requestStats {
+	return &requestStats{start: time.Now()}
+}
+
+// finish records the total request time.
+func (st *requestStats) finish() {
+	st.total = time.Since(st.start)
+}
+
+func (st *requestStats) usage() usageJSON {
+	rtf := 0.0
+	if st.audioDuration > 0 {
+		rtf = st.total.Seconds() / st.audioDuration
+	}
+	return usageJSON{
+		AudioDuration:  st.audioDuration,
+		RealTimeFactor: rtf,
+		GPU:            st.gpu,
+	}
+}
+
+func (st *requestStats) timings() timingsJSON {
+	t := timingsJSON{
+		AudioDecodeMs: durationMs(st.audioDecode),
+		DiarizeMs:     durationMs(st.diarize),
+		TranscribeMs:  durationMs(st.transcribe),
+		TotalMs:       durationMs(st.total),
+	}
+	if w := st.whisper; w.Runs > 0 {
+		t.SampleAvgMs, t.EncodeAvgMs, t.DecodeAvgMs = &w.SampleAvgMs, &w.EncodeAvgMs, &w.DecodeAvgMs
+		t.BatchdAvgMs, t.PromptAvgMs = &w.BatchdAvgMs, &w.PromptAvgMs
+	}
+	return t
+}
+
+// setHeaders reports the stats as X-Sona-* response headers.
+func (st *requestStats) setHeaders(h http.Header) {
+	u := st.usage()
+	t := st.timings()
+	h.Set("X-Sona-Audio-Duration", formatStat(u.AudioDuration))
+	h.Set("X-Sona-Real-Time-Factor", formatStat(u.RealTimeFactor))
+	h.Set("X-Sona-GPU", strconv.FormatBool(u.GPU))
+	h.Set("X-Sona-Audio-Decode-Ms", formatStat(t.AudioDecodeMs))
+	if t.DiarizeMs > 0 {
+		h.Set("X-Sona-Diarize-Ms", formatStat(t.DiarizeMs))
+	}
+	h.Set("X-Sona-Transcribe-Ms", formatStat(t.TranscribeMs))
+	if t.EncodeAvgMs != nil {
+		h.Set("X-Sona-Encode-Avg-Ms", formatStat(*t.EncodeAvgMs))
+		h.Set("X-Sona-Decode-Avg-Ms", formatStat(*t.DecodeAvgMs))
+	}
+	h.Set("X-Sona-Total-Ms", formatStat(t.TotalMs))
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func formatStat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
@@ -2,13 +2,50 @@ package wav
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
+
+	"github.com/thewh1teagle/sona/internal/resample"
+)
+
+// SampleRate is the rate Read resamples to.
+const SampleRate = 16000
+
+// Audio format codes from the fmt chunk.
+const (
+	FormatPCM        = 1
+	FormatIEEEFloat  = 3
+	FormatExtensible = 0xFFFE
+)
+
+// maxFmtSize bounds the fmt chunk we are willing to read; WAVE_FORMAT_EXTENSIBLE
+// needs 40 bytes.
+const maxFmtSize = 1 << 10
+
+// MaxSampleRate is the highest sample rate Supported accepts; anything
+// above it is a corrupt or hostile header, not a recording.
+const MaxSampleRate = 768000
+
+// UnknownSize is the data size DataChunk reports when the header does not
+// say how long the data is (0 or 0xFFFFFFFF, as written by recorders that
+// never finalize it). The data then runs until EOF.
+const UnknownSize = -1
+
+// Errors for files that are not WAVs or whose headers are inconsistent.
+var (
+	ErrNotWAV      = errors.New("not a valid WAV file")
+	ErrNoFmt       = errors.New("WAV has no fmt chunk before its data")
+	ErrNoData      = errors.New("WAV has no data chunk")
+	ErrMalformed   = errors.New("malformed WAV header")
+	ErrTruncated   = errors.New("WAV file is truncated")
+	ErrUnsupported = errors.New("unsupported WAV format")
 )
 
-// Header contains WAV format metadata.
+// Header contains WAV format metadata. For WAVE_FORMAT_EXTENSIBLE files,
+// AudioFormat holds the sub-format (PCM or IEEE float) rather than 0xFFFE.
 type Header struct {
 	AudioFormat   uint16
 	Channels      uint16
@@ -17,131 +54,281 @@ type Header struct {
 }
 
 // IsNative returns true if the WAV is already 16kHz mono 16-bit PCM
-// and can be decoded without ffmpeg.
+// and can be decoded without conversion.
 func (h Header) IsNative() bool {
-	return h.AudioFormat == 1 && h.Channels == 1 && h.SampleRate == 16000 && h.BitsPerSample == 16
+	return h.AudioFormat == FormatPCM && h.Channels == 1 && h.SampleRate == SampleRate && h.BitsPerSample == 16
 }
 
-// ReadHeader reads the WAV header and seeks back to the start.
-// Returns an error if the file is not a valid WAV.
-func ReadHeader(r io.ReadSeeker) (Header, error) {
-	var riff [12]byte
-	if _, err := io.ReadFull(r, riff[:]); err != nil {
-		return Header{}, fmt.Errorf("failed to read WAV header: %w", err)
-	}
-	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
-		r.Seek(0, io.SeekStart)
-		return Header{}, fmt.Errorf("not a valid WAV file")
+// Supported returns an error if the sample format cannot be decoded: only
+// 8/16/24/32-bit PCM and 32/64-bit IEEE float are.
+func (h Header) Supported() error {
+	switch {
+	case h.Channels == 0:
+		return fmt.Errorf("%w: no channels", ErrMalformed)
+	case h.SampleRate == 0:
+		return fmt.Errorf("%w: sample rate of 0", ErrMalformed)
+	case h.SampleRate > MaxSampleRate:
+		return fmt.Errorf("%w: sample rate %d (at most %d)", ErrUnsupported, h.SampleRate, MaxSampleRate)
+	case h.AudioFormat == FormatPCM:
+		switch h.BitsPerSample {
+		case 8, 16, 24, 32:
+			return nil
+		}
+		return fmt.Errorf("%w: PCM bits per sample %d (8, 16, 24 or 32)", ErrUnsupported, h.BitsPerSample)
+	case h.AudioFormat == FormatIEEEFloat:
+		switch h.BitsPerSample {
+		case 32, 64:
+			return nil
+		}
+		return fmt.Errorf("%w: float bits per sample %d (32 or 64)", ErrUnsupported, h.BitsPerSample)
 	}
+	return fmt.Errorf("%w: audio format %d (PCM=1 or IEEE float=3)", ErrUnsupported, h.AudioFormat)
+}
 
-	var h Header
-	for {
-		var chunkID [4]byte
-		var chunkSize uint32
-		if err := binary.Read(r, binary.LittleEndian, &chunkID); err != nil {
-			r.Seek(0, io.SeekStart)
-			return Header{}, fmt.Errorf("unexpected end of file: %w", err)
-		}
-		if err := binary.Read(r, binary.LittleEndian, &chunkSize); err != nil {
-			r.Seek(0, io.SeekStart)
-			return Header{}, fmt.Errorf("could not read chunk size: %w", err)
+// FrameSize returns the size in bytes of one sample across all channels.
+func (h Header) FrameSize() int {
+	return int(h.Channels) * int(h.BitsPerSample/8)
+}
+
+// DecodeMono converts whole frames of raw sample data to mono samples in
+// [-1, 1], averaging the channels, and appends them to dst. The header must
+// be Supported. A trailing partial frame is ignored.
+func (h Header) DecodeMono(dst []float32, raw []byte) []float32 {
+	channels := int(h.Channels)
+	width := int(h.BitsPerSample / 8)
+	sample := sampleDecoder(h.AudioFormat, width)
+	for off := 0; off+channels*width <= len(raw); off += channels * width {
+		var sum float64
+		for ch := range channels {
+			sum += sample(raw[off+ch*width:])
 		}
+		dst = append(dst, float32(sum/float64(channels)))
+	}
+	return dst
+}
 
-		if string(chunkID[:]) == "fmt " {
-			var fmtBuf [16]byte
-			if _, err := io.ReadFull(r, fmtBuf[:]); err != nil {
-				r.Seek(0, io.SeekStart)
-				return Header{}, fmt.Errorf("failed to read fmt chunk: %w", err)
-			}
-			h.AudioFormat = binary.LittleEndian.Uint16(fmtBuf[0:2])
-			h.Channels = binary.LittleEndian.Uint16(fmtBuf[2:4])
-			h.SampleRate = binary.LittleEndian.Uint32(fmtBuf[4:8])
-			h.BitsPerSample = binary.LittleEndian.Uint16(fmtBuf[14:16])
-			r.Seek(0, io.SeekStart)
-			return h, nil
+// Decode converts whole frames of raw sample data to interleaved samples in
+// [-1, 1] and appends them to dst. The header must be Supported.
+func (h Header) Decode(dst []float32, raw []byte) []float32 {
+	width := int(h.BitsPerSample / 8)
+	sample := sampleDecoder(h.AudioFormat, width)
+	n := len(raw) / h.FrameSize() * int(h.Channels)
+	for i := range n {
+		dst = append(dst, float32(sample(raw[i*width:])))
+	}
+	return dst
+}
+
+// sampleDecoder returns a function decoding one little-endian sample.
+func sampleDecoder(format uint16, width int) func(b []byte) float64 {
+	if format == FormatIEEEFloat {
+		if width == 8 {
+			return func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+		}
+		return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	}
+	switch width {
+	case 1: // 8-bit PCM is unsigned
+		return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case 2:
+		return func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / math.MaxInt16 }
+	case 3:
+		return func(b []byte) float64 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float64(v) / (1 << 23)
 		}
+	default:
+		return func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	}
+}
 
-		if _, err := r.Seek(int64(chunkSize), io.SeekCurrent); err != nil {
-			r.Seek(0, io.SeekStart)
-			return Header{}, err
+// parseFmt decodes a fmt chunk, resolving WAVE_FORMAT_EXTENSIBLE to the
+// format code at the start of its sub-format GUID.
+func parseFmt(buf []byte) (Header, error) {
+	if len(buf) < 16 {
+		return Header{}, fmt.Errorf("%w: fmt chunk too short (%d bytes)", ErrMalformed, len(buf))
+	}
+	h := Header{
+		AudioFormat:   binary.LittleEndian.Uint16(buf[0:2]),
+		Channels:      binary.LittleEndian.Uint16(buf[2:4]),
+		SampleRate:    binary.LittleEndian.Uint32(buf[4:8]),
+		BitsPerSample: binary.LittleEndian.Uint16(buf[14:16]),
+	}
+	if h.AudioFormat == FormatExtensible {
+		if len(buf) < 26 {
+			return Header{}, fmt.Errorf("%w: WAVE_FORMAT_EXTENSIBLE fmt chunk too short (%d bytes)", ErrMalformed, len(buf))
 		}
+		h.AudioFormat = binary.LittleEndian.Uint16(buf[24:26])
 	}
+	return h, nil
 }
 
-// Read parses a 16-bit PCM WAV from an io.ReadSeeker and returns float32 samples in [-1, 1].
-// Assumes 16kHz mono — no resampling is done.
-func Read(r io.ReadSeeker) ([]float32, error) {
-	var header [12]byte
-	if _, err := io.ReadFull(r, header[:]); err != nil {
-		return nil, fmt.Errorf("failed to read WAV header: %w", err)
+// readFmt reads a fmt chunk of the given size.
+func readFmt(r io.Reader, size int64) (Header, error) {
+	if size > maxFmtSize {
+		return Header{}, fmt.Errorf("%w: fmt chunk too large (%d bytes)", ErrMalformed, size)
 	}
-	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
-		return nil, fmt.Errorf("not a valid WAV file")
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return Header{}, fmt.Errorf("%w: fmt chunk: %w", ErrTruncated, err)
 	}
+	return parseFmt(buf)
+}
 
-	var audioFormat, channels, bitsPerSample uint16
+// ReadHeader reads the WAV header and seeks back to the start.
+// Returns an error if the file is not a valid WAV.
+func ReadHeader(r io.ReadSeeker) (Header, error) {
+	h, _, err := parse(r, true)
+	r.Seek(0, io.SeekStart)
+	return h, err
+}
 
-	var dataSize uint32
-	for {
-		var chunkID [4]byte
-		var chunkSize uint32
-		if err := binary.Read(r, binary.LittleEndian, &chunkID); err != nil {
-			return nil, fmt.Errorf("unexpected end of file: %w", err)
+// DataChunk parses the RIFF header and fmt chunk and leaves r positioned at
+// the start of the sample data. It returns the format and the data size in
+// bytes, which is UnknownSize if the data runs until EOF. r need not be
+// seekable (e.g. a pipe), but sizes can then only be checked against the
+// file length when it is.
+func DataChunk(r io.Reader) (Header, int64, error) {
+	return parse(r, false)
+}
+
+// parse walks the chunks of a RIFF, RF64 or BW64 WAVE file. It stops after
+// the fmt chunk when headerOnly is set, and otherwise at the start of the
+// data chunk. Chunks are padded to an even size.
+func parse(r io.Reader, headerOnly bool) (Header, int64, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return Header{}, 0, fmt.Errorf("%w: %w", ErrNotWAV, err)
+	}
+	magic := string(riff[0:4])
+	if (magic != "RIFF" && magic != "RF64" && magic != "BW64") || string(riff[8:12]) != "WAVE" {
+		return Header{}, 0, ErrNotWAV
+	}
+	// The file size, if r can tell us, to catch chunks that claim too much.
+	seeker, _ := r.(io.Seeker)
+	end, pos := int64(-1), int64(12)
+	if seeker != nil {
+		var err error
+		if end, err = seeker.Seek(0, io.SeekEnd); err != nil {
+			end = -1
 		}
-		if err := binary.Read(r, binary.LittleEndian, &chunkSize); err != nil {
-			return nil, fmt.Errorf("could not read chunk size: %w", err)
+		if pos, err = seeker.Seek(12, io.SeekStart); err != nil {
+			return Header{}, 0, err
 		}
+	}
 
-		switch string(chunkID[:]) {
-		case "fmt ":
-			var fmtBuf [16]byte
-			if _, err := io.ReadFull(r, fmtBuf[:]); err != nil {
-				return nil, fmt.Errorf("failed to read fmt chunk: %w", err)
+	var h Header
+	haveFmt := false
+	ds64Data := int64(-1)
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if !haveFmt {
+				return Header{}, 0, ErrNoFmt
+			}
+			return Header{}, 0, ErrNoData
+		}
+		id := string(hdr[0:4])
+		size := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		start := pos + 8
+		read := int64(0) // bytes of the chunk body consumed below
+
+		switch {
+		case id == "ds64" && magic != "RIFF":
+			// 64-bit RIFF and data sizes for chunks that set theirs to 0xFFFFFFFF.
+			if size < 16 {
+				return Header{}, 0, fmt.Errorf("%w: ds64 chunk too short (%d bytes)", ErrMalformed, size)
+			}
+			var sizes [16]byte
+			if _, err := io.ReadFull(r, sizes[:]); err != nil {
+				return Header{}, 0, fmt.Errorf("%w: ds64 chunk: %w", ErrTruncated, err)
+			}
+			ds64Data = int64(binary.LittleEndian.Uint64(sizes[8:16]))
+			if ds64Data < 0 {
+				return Header{}, 0, fmt.Errorf("%w: ds64 data size overflows", ErrMalformed)
 			}
-			audioFormat = binary.LittleEndian.Uint16(fmtBuf[0:2])
-			channels = binary.LittleEndian.Uint16(fmtBuf[2:4])
-			bitsPerSample = binary.LittleEndian.Uint16(fmtBuf[14:16])
-			if chunkSize > 16 {
-				if _, err := r.Seek(int64(chunkSize-16), io.SeekCurrent); err != nil {
-					return nil, err
+			read = 16
+		case id == "fmt ":
+			var err error
+			if h, err = readFmt(r, size); err != nil {
+				return Header{}, 0, err
+			}
+			haveFmt = true
+			if headerOnly {
+				return h, 0, nil
+			}
+			read = size
+		case id == "data":
+			if !haveFmt {
+				return Header{}, 0, ErrNoFmt
+			}
+			switch {
+			case size == math.MaxUint32 && magic != "RIFF":
+				if ds64Data < 0 {
+					return Header{}, 0, fmt.Errorf("%w: %s data size needs a ds64 chunk", ErrMalformed, magic)
 				}
+				size = ds64Data
+			case size == 0 || size == math.MaxUint32:
+				return h, UnknownSize, nil
 			}
-		case "data":
-			dataSize = chunkSize
-			goto readData
-		default:
-			if _, err := r.Seek(int64(chunkSize), io.SeekCurrent); err != nil {
-				return nil, err
+			if end >= 0 && start+size > end {
+				return Header{}, 0, fmt.Errorf("%w: data chunk claims %d bytes, file has %d", ErrTruncated, size, end-start)
 			}
+			return h, size, nil
 		}
-	}
 
-readData:
-	if audioFormat != 1 {
-		return nil, fmt.Errorf("unsupported audio format %d (only PCM=1)", audioFormat)
+		// Skip the rest of the chunk and its pad byte.
+		next := start + size + size&1
+		if end >= 0 && next > end {
+			return Header{}, 0, fmt.Errorf("%w: %q chunk runs past the end of the file", ErrTruncated, id)
+		}
+		if err := skip(r, seeker, start+read, next); err != nil {
+			return Header{}, 0, fmt.Errorf("%w: %q chunk: %w", ErrTruncated, id, err)
+		}
+		pos = next
 	}
-	if bitsPerSample != 16 {
-		return nil, fmt.Errorf("unsupported bits per sample %d (only 16)", bitsPerSample)
+}
+
+// skip advances r from offset cur to next, seeking when it can.
+func skip(r io.Reader, seeker io.Seeker, cur, next int64) error {
+	if seeker != nil {
+		_, err := seeker.Seek(next, io.SeekStart)
+		return err
 	}
+	_, err := io.CopyN(io.Discard, r, next-cur)
+	return err
+}
 
-	nSamples := int(dataSize) / int(channels) / 2
-	if nSamples == 0 {
-		return nil, fmt.Errorf("audio file contains no samples")
+// Read parses a WAV from an io.ReadSeeker and returns 16kHz mono float32
+// samples in [-1, 1]. Channels are averaged and other sample rates are
+// resampled. A data chunk of unknown size is read until EOF.
+func Read(r io.ReadSeeker) ([]float32, error) {
+	h, dataSize, err := DataChunk(r)
+	if err != nil {
+		return nil, err
 	}
-	raw := make([]int16, int(dataSize)/2)
-	if err := binary.Read(r, binary.LittleEndian, raw); err != nil {
-		return nil, fmt.Errorf("failed to read PCM data: %w", err)
+	if err := h.Supported(); err != nil {
+		return nil, err
 	}
 
-	samples := make([]float32, nSamples)
-	for i := 0; i < nSamples; i++ {
-		var sum float64
-		for ch := 0; ch < int(channels); ch++ {
-			sum += float64(raw[i*int(channels)+ch])
+	var raw []byte
+	if dataSize == UnknownSize {
+		if raw, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("failed to read sample data: %w", err)
 		}
-		samples[i] = float32(sum / float64(channels) / math.MaxInt16)
+	} else {
+		raw = make([]byte, dataSize)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrTruncated, err)
+		}
+	}
+	nFrames := len(raw) / h.FrameSize()
+	if nFrames == 0 {
+		return nil, fmt.Errorf("audio file contains no samples")
 	}
-	return samples, nil
+
+	samples := h.DecodeMono(make([]float32, 0, nFrames), raw)
+	return resample.Convert(samples, int(h.SampleRate), SampleRate), nil
 }
 
 // ReadFile opens a WAV file by path and returns float32 samples.
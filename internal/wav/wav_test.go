@@ -0,0 +1,201 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+// build returns a WAV with the given fmt chunk body and raw sample data.
+func build(fmtChunk []byte, data []byte) []byte {
+	return riff("RIFF", chunk("fmt ", fmtChunk), chunk("data", data))
+}
+
+// riff wraps chunks in a WAVE file with the given magic.
+func riff(magic string, chunks ...[]byte) []byte {
+	body := bytes.Join(chunks, nil)
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.LittleEndian, uint32(4+len(body)))
+	buf.WriteString("WAVE")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// chunk encodes a chunk with its pad byte.
+func chunk(id string, body []byte) []byte {
+	return sizedChunk(id, uint32(len(body)), body)
+}
+
+// sizedChunk encodes a chunk whose header claims size, whatever body holds.
+func sizedChunk(id string, size uint32, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(id)
+	binary.Write(&buf, binary.LittleEndian, size)
+	buf.Write(body)
+	if len(body)%2 == 1 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func fmtChunk(format, channels uint16, rate uint32, bits uint16) []byte {
+	var buf bytes.Buffer
+	align := channels * bits / 8
+	for _, v := range []any{format, channels, rate, rate * uint32(align), align, bits} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func extensibleChunk(subFormat, channels uint16, rate uint32, bits uint16) []byte {
+	buf := bytes.NewBuffer(fmtChunk(FormatExtensible, channels, rate, bits))
+	for _, v := range []any{uint16(22), bits, uint32(3), subFormat} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	buf.Write([]byte("\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71")) // rest of the GUID
+	return buf.Bytes()
+}
+
+func TestReadFormats(t *testing.T) {
+	le := func(vs ...any) []byte {
+		var buf bytes.Buffer
+		for _, v := range vs {
+			binary.Write(&buf, binary.LittleEndian, v)
+		}
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name string
+		fmt  []byte
+		data []byte
+		want []float32
+	}{
+		{"pcm8", fmtChunk(FormatPCM, 1, 16000, 8), []byte{128, 192, 64}, []float32{0, 0.5, -0.5}},
+		{"pcm16", fmtChunk(FormatPCM, 1, 16000, 16), le(int16(0), int16(16384), int16(-32767)), []float32{0, 0.5, -1}},
+		{"pcm24", fmtChunk(FormatPCM, 1, 16000, 24), []byte{0, 0, 0, 0, 0, 0x40, 0, 0, 0xC0}, []float32{0, 0.5, -0.5}},
+		{"pcm32", fmtChunk(FormatPCM, 1, 16000, 32), le(int32(0), int32(1<<30), int32(-1<<30)), []float32{0, 0.5, -0.5}},
+		{"float32", fmtChunk(FormatIEEEFloat, 1, 16000, 32), le(float32(0), float32(0.5), float32(-0.25)), []float32{0, 0.5, -0.25}},
+		{"float64", fmtChunk(FormatIEEEFloat, 1, 16000, 64), le(0.0, 0.5, -0.25), []float32{0, 0.5, -0.25}},
+		{"stereo", fmtChunk(FormatPCM, 2, 16000, 16), le(int16(16384), int16(0), int16(-16384), int16(-16384)), []float32{0.25, -0.5}},
+		{"extensible float", extensibleChunk(FormatIEEEFloat, 2, 16000, 32), le(float32(0.5), float32(0.5), float32(1), float32(0)), []float32{0.5, 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(bytes.NewReader(build(tt.fmt, tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d samples, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if math.Abs(float64(got[i]-tt.want[i])) > 1e-4 {
+					t.Errorf("sample %d = %f, want %f", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadResamples(t *testing.T) {
+	data := make([]byte, 44100*2*2) // 1 s of 44.1kHz stereo silence
+	got, err := Read(bytes.NewReader(build(fmtChunk(FormatPCM, 2, 44100, 16), data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != SampleRate {
+		t.Errorf("got %d samples, want %d", len(got), SampleRate)
+	}
+}
+
+func TestReadUnsupported(t *testing.T) {
+	for name, chunk := range map[string][]byte{
+		"alaw":    fmtChunk(6, 1, 8000, 8),
+		"pcm12":   fmtChunk(FormatPCM, 1, 16000, 12),
+		"float16": fmtChunk(FormatIEEEFloat, 1, 16000, 16),
+		"rate":    fmtChunk(FormatPCM, 1, math.MaxUint32, 16),
+	} {
+		if _, err := Read(bytes.NewReader(build(chunk, make([]byte, 4)))); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: got %v, want ErrUnsupported", name, err)
+		}
+	}
+}
+
+func TestReadChunkLayouts(t *testing.T) {
+	mono16 := fmtChunk(FormatPCM, 1, 16000, 16)
+	data := []byte{0, 0x40, 0, 0xC0} // 0.5, -0.5
+	ds64 := func(dataSize uint64) []byte {
+		body := make([]byte, 28)
+		binary.LittleEndian.PutUint64(body[8:16], dataSize)
+		return chunk("ds64", body)
+	}
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"odd chunk padding", riff("RIFF", chunk("LIST", []byte("abc")), chunk("fmt ", mono16), chunk("data", data))},
+		{"rf64", riff("RF64", ds64(4), chunk("fmt ", mono16), sizedChunk("data", math.MaxUint32, data))},
+		{"bw64", riff("BW64", ds64(4), chunk("fmt ", mono16), sizedChunk("data", math.MaxUint32, data))},
+		{"unfinalized size 0", riff("RIFF", chunk("fmt ", mono16), sizedChunk("data", 0, data))},
+		{"unfinalized size max", riff("RIFF", chunk("fmt ", mono16), sizedChunk("data", math.MaxUint32, data))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(bytes.NewReader(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 || got[0] < 0.49 || got[1] > -0.49 {
+				t.Errorf("got %v, want [0.5 -0.5]", got)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	mono16 := fmtChunk(FormatPCM, 1, 16000, 16)
+	tests := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"not wav", []byte("ID3\x04\x00\x00\x00\x00\x00\x00\x00\x00"), ErrNotWAV},
+		{"empty", nil, ErrNotWAV},
+		{"data before fmt", riff("RIFF", chunk("data", []byte{0, 0}), chunk("fmt ", mono16)), ErrNoFmt},
+		{"no data", riff("RIFF", chunk("fmt ", mono16)), ErrNoData},
+		{"data too long", riff("RIFF", chunk("fmt ", mono16), sizedChunk("data", 1000, []byte{0, 0})), ErrTruncated},
+		{"chunk too long", riff("RIFF", sizedChunk("LIST", 1000, nil), chunk("fmt ", mono16)), ErrTruncated},
+		{"rf64 without ds64", riff("RF64", chunk("fmt ", mono16), sizedChunk("data", math.MaxUint32, []byte{0, 0})), ErrMalformed},
+		{"short fmt", riff("RIFF", chunk("fmt ", mono16[:8]), chunk("data", []byte{0, 0})), ErrMalformed},
+		{"adpcm", build(fmtChunk(2, 1, 16000, 4), []byte{0, 0}), ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.file))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataChunkUnseekable(t *testing.T) {
+	mono16 := fmtChunk(FormatPCM, 1, 16000, 16)
+	data := []byte{0, 0x40, 0, 0xC0}
+	file := riff("RIFF", chunk("LIST", []byte("abc")), chunk("fmt ", mono16), chunk("data", data))
+	r := struct{ io.Reader }{bytes.NewReader(file)} // hides Seek, as a pipe would
+	h, size, err := DataChunk(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.IsNative() || size != int64(len(data)) {
+		t.Errorf("got %+v, size %d", h, size)
+	}
+	if rest, _ := io.ReadAll(r); !bytes.Equal(rest, data) {
+		t.Errorf("reader left at %v, want the sample data", rest)
+	}
+}
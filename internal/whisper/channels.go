@@ -0,0 +1,57 @@
+package whisper
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// TranscribeChannels transcribes each channel of a recording on its own and
+// merges the segments in order of start time, each labeled with its 1-based
+// Channel: numbers[k] for channels[k], or k+1 when numbers is nil. This
+// separates speakers recorded on their own channels (a phone call, an
+// interview with two microphones) without a diarization model.
+// Channels are transcribed one after another; progress covers all of them.
+// OnSegment sees the merged segments once every channel is done, since a
+// later channel can produce earlier segments.
+func TranscribeChannels(t ChunkTranscriber, channels [][]float32, numbers []int, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	if len(channels) == 0 {
+		return TranscribeResult{}, errors.New("whisper: no samples")
+	}
+	if numbers != nil && len(numbers) != len(channels) {
+		return TranscribeResult{}, fmt.Errorf("whisper: %d channel numbers for %d channels", len(numbers), len(channels))
+	}
+	var result TranscribeResult
+	for k, samples := range channels {
+		number := k + 1
+		if numbers != nil {
+			number = numbers[k]
+		}
+		chanCB := cb
+		chanCB.OnSegment = nil
+		if cb.OnProgress != nil {
+			chanCB.OnProgress = func(p int) {
+				cb.OnProgress((k*100 + p) / len(channels))
+			}
+		}
+		res, err := t.TranscribeStream(samples, opts, chanCB)
+		if err != nil {
+			return TranscribeResult{}, fmt.Errorf("channel %d: %w", number, err)
+		}
+		for _, seg := range res.Segments {
+			seg.Channel = number
+			result.Segments = append(result.Segments, seg)
+		}
+		result.Timings = result.Timings.merge(res.Timings)
+	}
+	slices.SortStableFunc(result.Segments, func(a, b Segment) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	if cb.OnSegment != nil {
+		for _, seg := range result.Segments {
+			cb.OnSegment(seg)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package whisper
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// channelTranscriber returns preset segments for each call in turn.
+type channelTranscriber struct {
+	segments [][]Segment
+	calls    int
+	err      error
+}
+
+func (c *channelTranscriber) TranscribeStream(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	segs := c.segments[c.calls]
+	c.calls++
+	if c.err != nil && c.calls == len(c.segments) {
+		return TranscribeResult{}, c.err
+	}
+	if cb.OnProgress != nil {
+		cb.OnProgress(50)
+		cb.OnProgress(100)
+	}
+	return TranscribeResult{Segments: segs, Timings: Timings{EncodeAvgMs: float64(c.calls), Runs: 1}}, nil
+}
+
+func (c *channelTranscriber) Tokenize(text string) []int32 { return nil }
+
+func TestTranscribeChannels(t *testing.T) {
+	tr := &channelTranscriber{segments: [][]Segment{
+		{{Start: 0, End: 100, Text: " a1"}, {Start: 300, End: 400, Text: " a2"}},
+		{{Start: 100, End: 200, Text: " b1"}, {Start: 300, End: 350, Text: " b2"}},
+	}}
+	var progress []int
+	var streamed []Segment
+	result, err := TranscribeChannels(tr, make([][]float32, 2), nil, TranscribeOptions{}, StreamCallbacks{
+		OnProgress: func(p int) { progress = append(progress, p) },
+		OnSegment:  func(seg Segment) { streamed = append(streamed, seg) },
+	})
+	if err != nil {
+		t.Fatalf("TranscribeChannels() error: %v", err)
+	}
+
+	if got := result.Text(); got != " a1 b1 a2 b2" {
+		t.Errorf("Text() = %q, want segments merged by start", got)
+	}
+	var channels []int
+	for _, seg := range result.Segments {
+		channels = append(channels, seg.Channel)
+	}
+	if want := []int{1, 2, 1, 2}; !slices.Equal(channels, want) {
+		t.Errorf("channels = %v, want %v", channels, want)
+	}
+	if !slices.EqualFunc(streamed, result.Segments, func(a, b Segment) bool { return a.Text == b.Text && a.Channel == b.Channel }) {
+		t.Errorf("streamed %v, want the merged segments", streamed)
+	}
+	if want := []int{25, 50, 75, 100}; !slices.Equal(progress, want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+	if result.Timings.EncodeAvgMs != 1.5 || result.Timings.Runs != 2 {
+		t.Errorf("timings = %+v, want averages over both channels", result.Timings)
+	}
+}
+
+func TestTranscribeChannelsNumbers(t *testing.T) {
+	// Source channel 2 was a copy of 1 and dropped; 3 keeps its number.
+	tr := &channelTranscriber{segments: [][]Segment{
+		{{Start: 0, End: 100, Text: " a"}},
+		{{Start: 100, End: 200, Text: " c"}},
+	}}
+	result, err := TranscribeChannels(tr, make([][]float32, 2), []int{1, 3}, TranscribeOptions{}, StreamCallbacks{})
+	if err != nil {
+		t.Fatalf("TranscribeChannels() error: %v", err)
+	}
+	if result.Segments[0].Channel != 1 || result.Segments[1].Channel != 3 {
+		t.Errorf("segments = %+v, want channels 1 and 3", result.Segments)
+	}
+	if _, err := TranscribeChannels(tr, make([][]float32, 2), []int{1}, TranscribeOptions{}, StreamCallbacks{}); err == nil {
+		t.Error("TranscribeChannels() with too few numbers succeeded, want error")
+	}
+}
+
+func TestTranscribeChannelsError(t *testing.T) {
+	errFail := errors.New("fail")
+	tr := &channelTranscriber{segments: make([][]Segment, 2), err: errFail}
+	_, err := TranscribeChannels(tr, make([][]float32, 2), []int{1, 3}, TranscribeOptions{}, StreamCallbacks{})
+	if !errors.Is(err, errFail) || err.Error() != "channel 3: fail" {
+		t.Errorf("TranscribeChannels() error = %v, want channel 3 failure", err)
+	}
+	if _, err := TranscribeChannels(tr, nil, nil, TranscribeOptions{}, StreamCallbacks{}); err == nil {
+		t.Error("TranscribeChannels() of no channels succeeded, want error")
+	}
+}
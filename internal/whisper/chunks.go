@@ -0,0 +1,172 @@
+package whisper
+
+import (
+	"errors"
+	"io"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+)
+
+const (
+	// chunkSampleRate is the rate of samples passed to TranscribeStream.
+	chunkSampleRate = 16000
+	// maxPromptTokens is the most context whisper.cpp keeps from a prompt:
+	// half of the 448-token text context.
+	maxPromptTokens = 224
+)
+
+// ChunkTranscriber is the part of Context that TranscribeChunks needs.
+type ChunkTranscriber interface {
+	TranscribeStream(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error)
+	Tokenize(text string) []int32
+}
+
+// ChunkSource yields consecutive chunks of 16kHz mono audio.
+type ChunkSource interface {
+	// Next returns the next chunk and its start in seconds, or io.EOF.
+	Next() (samples []float32, start float64, err error)
+	// Duration returns the total length in seconds, or 0 if unknown.
+	Duration() float64
+}
+
+// TranscribeChunks transcribes audio one chunk at a time so that long inputs
+// never need to be decoded in full. Each chunk is decoded with the tail of
+// the text so far as its prompt, and segments carry absolute timestamps
+// (opts.TimeOffset plus the chunk start). opts.Offset and opts.Duration are
+// ignored; the source is expected to cover only the wanted range. Progress
+// is reported across all chunks when the source knows its duration.
+//
+// A chunk may start up to audio.ChunkOverlap seconds before the previous one
+// ended; the segments transcribed twice are then kept from the later chunk,
+// so segments starting near a chunk's end reach OnSegment only once the
+// next chunk is known.
+func TranscribeChunks(t ChunkTranscriber, src ChunkSource, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	base := opts.TimeOffset
+	opts.Offset, opts.Duration = 0, 0
+	total := src.Duration()
+
+	var result TranscribeResult
+	kept := overlapFilter{emit: func(seg Segment) { result.Segments = append(result.Segments, seg) }}
+	streamed := overlapFilter{emit: cb.OnSegment}
+	var carried []int32
+	decoded := false
+	for first := true; ; first = false {
+		samples, start, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return TranscribeResult{}, err
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		decoded = true
+
+		chunkOpts := opts
+		chunkOpts.TimeOffset = base + start
+		if !first {
+			chunkOpts.Prompt = ""
+			chunkOpts.PromptTokens = carried
+		}
+		at := secondsToCS(base + start)
+		end := secondsToCS(base + start + float64(len(samples))/chunkSampleRate)
+		kept.next(at, end)
+		chunkCB := cb
+		if cb.OnSegment != nil {
+			streamed.next(at, end)
+			chunkCB.OnSegment = streamed.add
+		}
+		chunkCB.OnProgress = nil
+		if cb.OnProgress != nil && total > 0 {
+			length := float64(len(samples)) / chunkSampleRate
+			chunkCB.OnProgress = func(p int) {
+				cb.OnProgress(min(100, int((start+length*float64(p)/100)*100/total)))
+			}
+		}
+
+		res, err := t.TranscribeStream(samples, chunkOpts, chunkCB)
+		if err != nil {
+			return TranscribeResult{}, err
+		}
+		for _, seg := range res.Segments {
+			kept.add(seg)
+		}
+		result.Timings = result.Timings.merge(res.Timings)
+
+		if first {
+			carried = append(carried, opts.PromptTokens...)
+			if opts.Prompt != "" {
+				carried = append(carried, t.Tokenize(opts.Prompt)...)
+			}
+		}
+		carried = lastTokens(append(carried, t.Tokenize(res.Text())...), maxPromptTokens)
+	}
+	if !decoded {
+		return TranscribeResult{}, errors.New("whisper: no samples")
+	}
+	kept.flush()
+	if cb.OnSegment != nil {
+		streamed.flush()
+	}
+	return result, nil
+}
+
+// overlapFilter passes on the segments of consecutive chunks, dropping those
+// transcribed twice where a chunk overlaps the one before it. Times are in
+// centiseconds.
+type overlapFilter struct {
+	emit    func(Segment)
+	pending []Segment // segments in the last ChunkOverlap of the chunk
+	hold    int64     // segments starting from here are held as pending
+	end     int64     // end of the chunk
+	keptEnd int64     // end of the last emitted segment
+	overlap bool      // the chunk starts before the previous one ended
+}
+
+// next starts a chunk covering [at, end). Pending segments of the previous
+// chunk that start inside it are dropped in favour of its own.
+func (f *overlapFilter) next(at, end int64) {
+	f.overlap = at < f.end
+	for _, seg := range f.pending {
+		if !f.overlap || seg.Start < at {
+			f.send(seg)
+		}
+	}
+	f.pending = f.pending[:0]
+	f.hold = end - secondsToCS(audio.ChunkOverlap)
+	f.end = end
+}
+
+// add passes on a segment of the current chunk, dropping it if the chunk
+// overlaps the previous one and that already covered most of the segment.
+func (f *overlapFilter) add(seg Segment) {
+	switch {
+	case f.overlap && (seg.Start+seg.End)/2 < f.keptEnd:
+	case seg.Start >= f.hold:
+		f.pending = append(f.pending, seg)
+	default:
+		f.send(seg)
+	}
+}
+
+// flush passes on the pending segments of the last chunk.
+func (f *overlapFilter) flush() {
+	for _, seg := range f.pending {
+		f.send(seg)
+	}
+	f.pending = nil
+}
+
+func (f *overlapFilter) send(seg Segment) {
+	f.keptEnd = max(f.keptEnd, seg.End)
+	f.emit(seg)
+}
+
+// lastTokens returns a copy of at most the last n tokens.
+func lastTokens(tokens []int32, n int) []int32 {
+	if len(tokens) > n {
+		tokens = tokens[len(tokens)-n:]
+	}
+	return append([]int32(nil), tokens...)
+}
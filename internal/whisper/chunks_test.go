@@ -0,0 +1,162 @@
+package whisper
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+)
+
+// scriptedChunks yields fixed chunks of silence.
+type scriptedChunks struct {
+	lengths []int // samples per chunk
+	overlap int   // samples each later chunk repeats of the one before
+	pos     int
+	next    int
+}
+
+func (s *scriptedChunks) Next() ([]float32, float64, error) {
+	if s.next == len(s.lengths) {
+		return nil, 0, io.EOF
+	}
+	n := s.lengths[s.next]
+	if s.next > 0 {
+		s.pos -= s.overlap
+	}
+	start := float64(s.pos) / chunkSampleRate
+	s.pos += n
+	s.next++
+	return make([]float32, n), start, nil
+}
+
+func (s *scriptedChunks) Duration() float64 {
+	total := 0
+	for i, n := range s.lengths {
+		total += n
+		if i > 0 {
+			total -= s.overlap
+		}
+	}
+	return float64(total) / chunkSampleRate
+}
+
+// echoTranscriber returns one segment per chunk spanning the chunk, with a
+// word per chunk, and records the options of each call.
+type echoTranscriber struct {
+	calls []TranscribeOptions
+}
+
+func (e *echoTranscriber) TranscribeStream(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	e.calls = append(e.calls, opts)
+	seg := Segment{Start: 0, End: int64(len(samples)) * 100 / chunkSampleRate, Text: " w" + string(rune('a'+len(e.calls)-1))}
+	seg = seg.shift(secondsToCS(opts.TimeOffset))
+	if cb.OnProgress != nil {
+		cb.OnProgress(100)
+	}
+	if cb.OnSegment != nil {
+		cb.OnSegment(seg)
+	}
+	return TranscribeResult{Segments: []Segment{seg}, Timings: Timings{EncodeAvgMs: float64(len(e.calls)), Runs: 1}}, nil
+}
+
+func (e *echoTranscriber) Tokenize(text string) []int32 {
+	var tokens []int32
+	for _, w := range strings.Fields(text) {
+		tokens = append(tokens, int32(w[len(w)-1]))
+	}
+	return tokens
+}
+
+func TestTranscribeChunks(t *testing.T) {
+	src := &scriptedChunks{lengths: []int{2 * chunkSampleRate, 3 * chunkSampleRate, chunkSampleRate}}
+	tr := &echoTranscriber{}
+	var progress []int
+	var streamed []Segment
+	result, err := TranscribeChunks(tr, src, TranscribeOptions{Prompt: "p", TimeOffset: 10, Offset: 5}, StreamCallbacks{
+		OnProgress: func(p int) { progress = append(progress, p) },
+		OnSegment:  func(seg Segment) { streamed = append(streamed, seg) },
+	})
+	if err != nil {
+		t.Fatalf("TranscribeChunks() error: %v", err)
+	}
+
+	if got := result.Text(); got != " wa wb wc" {
+		t.Errorf("Text() = %q", got)
+	}
+	wantStarts := []int64{1000, 1200, 1500}
+	for i, seg := range result.Segments {
+		if seg.Start != wantStarts[i] {
+			t.Errorf("segment %d start = %d, want %d", i, seg.Start, wantStarts[i])
+		}
+	}
+	if len(streamed) != 3 {
+		t.Errorf("streamed %d segments, want 3", len(streamed))
+	}
+	if want := []int{33, 83, 100}; !slices.Equal(progress, want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+	if result.Timings.EncodeAvgMs != 2 || result.Timings.Runs != 3 {
+		t.Errorf("timings = %+v, want averages over the chunks", result.Timings)
+	}
+
+	// The first chunk keeps the caller's prompt; later chunks carry the text.
+	if tr.calls[0].Prompt != "p" || tr.calls[0].Offset != 0 {
+		t.Errorf("first call options = %+v", tr.calls[0])
+	}
+	if got, want := tr.calls[2].PromptTokens, []int32{'p', 'a', 'b'}; tr.calls[2].Prompt != "" || !slices.Equal(got, want) {
+		t.Errorf("third call prompt = %q, tokens %v, want tokens %v", tr.calls[2].Prompt, got, want)
+	}
+}
+
+// secondsTranscriber returns a segment for each second of a chunk, named
+// after its absolute second.
+type secondsTranscriber struct{}
+
+func (secondsTranscriber) TranscribeStream(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	var res TranscribeResult
+	for i := range len(samples) / chunkSampleRate {
+		at := secondsToCS(opts.TimeOffset) + int64(i)*100
+		seg := Segment{Start: at, End: at + 100, Text: fmt.Sprintf(" s%d", at/100)}
+		if cb.OnSegment != nil {
+			cb.OnSegment(seg)
+		}
+		res.Segments = append(res.Segments, seg)
+	}
+	return res, nil
+}
+
+func (secondsTranscriber) Tokenize(string) []int32 { return nil }
+
+func TestTranscribeChunksOverlap(t *testing.T) {
+	overlap := int(audio.ChunkOverlap * chunkSampleRate)
+	src := &scriptedChunks{lengths: []int{3 * chunkSampleRate, 3 * chunkSampleRate, 2 * chunkSampleRate}, overlap: overlap}
+	var streamed []Segment
+	result, err := TranscribeChunks(secondsTranscriber{}, src, TranscribeOptions{}, StreamCallbacks{
+		OnSegment: func(seg Segment) { streamed = append(streamed, seg) },
+	})
+	if err != nil {
+		t.Fatalf("TranscribeChunks() error: %v", err)
+	}
+	// The chunks cover 0-3s, 2-5s and 4-6s; each second is kept once.
+	if got, want := result.Text(), " s0 s1 s2 s3 s4 s5"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+	if got := (TranscribeResult{Segments: streamed}).Text(); got != result.Text() {
+		t.Errorf("streamed %q, want %q", got, result.Text())
+	}
+}
+
+func TestTranscribeChunksEmpty(t *testing.T) {
+	if _, err := TranscribeChunks(&echoTranscriber{}, &scriptedChunks{}, TranscribeOptions{}, StreamCallbacks{}); err == nil {
+		t.Error("TranscribeChunks() of empty source succeeded, want error")
+	}
+}
+
+func TestLastTokens(t *testing.T) {
+	if got := lastTokens([]int32{1, 2, 3, 4}, 2); !slices.Equal(got, []int32{3, 4}) {
+		t.Errorf("lastTokens() = %v", got)
+	}
+}
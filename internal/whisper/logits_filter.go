@@ -0,0 +1,76 @@
+package whisper
+
+import "math"
+
+// defaultHotwordBoost is added to hotword token logits when
+// TranscribeOptions.HotwordBoost is 0.
+const defaultHotwordBoost = 2.0
+
+// logitsFilter biases decoding towards hotword token sequences and away from
+// suppressed ones. Sequences are matched against the tail of the tokens
+// decoded so far, so multi-token words are boosted one token at a time.
+type logitsFilter struct {
+	boost    float32
+	hotwords []tokenSeq
+	suppress []tokenSeq
+	// special is the first special token id (whisper_token_eot); it and
+	// everything above, timestamps included, mark a segment boundary.
+	special int32
+}
+
+// tokenSeq is a word's tokens. Whisper writes words mid-sentence with a
+// leading space; the spelling without one is a subword that also occurs
+// inside other words, so atStart sequences only match at a segment start.
+type tokenSeq struct {
+	tokens  []int32
+	atStart bool
+}
+
+// apply adjusts logits in place given the tokens decoded so far.
+func (f *logitsFilter) apply(history []int32, logits []float32) {
+	for _, seq := range f.hotwords {
+		// Boost the next token of the longest partially matched prefix.
+		for k := len(seq.tokens) - 1; k >= 0; k-- {
+			if f.matches(history, seq, k) {
+				if id := int(seq.tokens[k]); id < len(logits) {
+					logits[id] += f.boost
+				}
+				break
+			}
+		}
+	}
+	for _, seq := range f.suppress {
+		last := len(seq.tokens) - 1
+		if f.matches(history, seq, last) {
+			if id := int(seq.tokens[last]); id < len(logits) {
+				logits[id] = float32(math.Inf(-1))
+			}
+		}
+	}
+}
+
+// matches reports whether history ends with the first k tokens of seq, so
+// that seq's token k may come next.
+func (f *logitsFilter) matches(history []int32, seq tokenSeq, k int) bool {
+	if !hasTokenSuffix(history, seq.tokens[:k]) {
+		return false
+	}
+	if !seq.atStart {
+		return true
+	}
+	before := history[:len(history)-k]
+	return len(before) == 0 || before[len(before)-1] >= f.special
+}
+
+func hasTokenSuffix(history, suffix []int32) bool {
+	if len(suffix) > len(history) {
+		return false
+	}
+	offset := len(history) - len(suffix)
+	for i, tok := range suffix {
+		if history[offset+i] != tok {
+			return false
+		}
+	}
+	return true
+}
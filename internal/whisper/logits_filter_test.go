@@ -0,0 +1,111 @@
+package whisper
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLogitsFilterHotwords(t *testing.T) {
+	f := &logitsFilter{boost: 2, hotwords: []tokenSeq{{tokens: []int32{5, 6, 7}}}, special: 100}
+
+	tests := []struct {
+		history []int32
+		boosted int
+	}{
+		{nil, 5},           // nothing matched yet: boost first token
+		{[]int32{1, 5}, 6}, // first token matched: boost second
+		{[]int32{5, 6}, 7}, // prefix matched: boost last
+		{[]int32{5, 6, 7}, 5},
+	}
+	for _, tt := range tests {
+		logits := make([]float32, 10)
+		f.apply(tt.history, logits)
+		for id, l := range logits {
+			want := float32(0)
+			if id == tt.boosted {
+				want = 2
+			}
+			if l != want {
+				t.Errorf("history %v: logits[%d] = %v, want %v", tt.history, id, l, want)
+			}
+		}
+	}
+}
+
+func TestLogitsFilterSuppress(t *testing.T) {
+	f := &logitsFilter{suppress: []tokenSeq{{tokens: []int32{3}}, {tokens: []int32{4, 8}}}, special: 100}
+
+	logits := make([]float32, 10)
+	f.apply([]int32{1, 2}, logits)
+	if !math.IsInf(float64(logits[3]), -1) {
+		t.Errorf("single-token word not suppressed: logits[3] = %v", logits[3])
+	}
+	if logits[8] != 0 {
+		t.Errorf("multi-token word suppressed without prefix: logits[8] = %v", logits[8])
+	}
+
+	logits = make([]float32, 10)
+	f.apply([]int32{1, 4}, logits)
+	if !math.IsInf(float64(logits[8]), -1) {
+		t.Errorf("multi-token word not suppressed after prefix: logits[8] = %v", logits[8])
+	}
+}
+
+func TestLogitsFilterSegmentStartSpelling(t *testing.T) {
+	// " um" is token 20; "um" is token 21, which also ends "album" (30 21).
+	// Tokens from 100 up are special; 150 is a timestamp.
+	um := func() *logitsFilter {
+		return &logitsFilter{suppress: []tokenSeq{{tokens: []int32{20}}, {tokens: []int32{21}, atStart: true}}, special: 100}
+	}
+	tests := []struct {
+		history []int32
+		bare    bool // whether "um" is suppressed
+	}{
+		{nil, true},
+		{[]int32{150}, true},
+		{[]int32{150, 30}, false}, // "alb" then "um" is "album"
+		{[]int32{150, 20}, false},
+	}
+	for _, tt := range tests {
+		logits := make([]float32, 200)
+		um().apply(tt.history, logits)
+		if !math.IsInf(float64(logits[20]), -1) {
+			t.Errorf("history %v: \" um\" not suppressed", tt.history)
+		}
+		if got := math.IsInf(float64(logits[21]), -1); got != tt.bare {
+			t.Errorf("history %v: \"um\" suppressed = %v, want %v", tt.history, got, tt.bare)
+		}
+	}
+
+	// The bare spelling of a hotword is only boosted, and continued, from a
+	// segment start.
+	f := &logitsFilter{boost: 2, hotwords: []tokenSeq{{tokens: []int32{40, 41}, atStart: true}}, special: 100}
+	for _, tt := range []struct {
+		history []int32
+		boosted int
+	}{
+		{[]int32{150}, 40},
+		{[]int32{150, 40}, 41},
+		{[]int32{150, 30}, -1},
+		{[]int32{150, 30, 40}, -1},
+	} {
+		logits := make([]float32, 200)
+		f.apply(tt.history, logits)
+		for id, l := range logits {
+			if want := id == tt.boosted; (l == 2) != want {
+				t.Errorf("history %v: logits[%d] = %v", tt.history, id, l)
+			}
+		}
+	}
+}
+
+func TestLogitsFilterIgnoresOutOfRangeTokens(t *testing.T) {
+	f := &logitsFilter{boost: 1, hotwords: []tokenSeq{{tokens: []int32{42}}}, suppress: []tokenSeq{{tokens: []int32{99}}}, special: 100}
+	logits := make([]float32, 4)
+	f.apply(nil, logits)
+	for id, l := range logits {
+		if l != 0 {
+			t.Errorf("logits[%d] = %v, want 0", id, l)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package whisper
+
+import (
+	"errors"
+	"io"
+)
+
+// modelReader streams a model file to whisper.cpp's whisper_model_loader
+// callbacks, so the model is never held in full in the Go heap.
+type modelReader struct {
+	r   io.Reader
+	eof bool
+	err error // first read error other than end of file
+}
+
+// read fills p and returns the number of bytes read. Short reads only
+// happen at end of input or on error, after which eof is set.
+func (m *modelReader) read(p []byte) int {
+	n, err := io.ReadFull(m.r, p)
+	if err != nil {
+		m.eof = true
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && m.err == nil {
+			m.err = err
+		}
+	}
+	return n
+}
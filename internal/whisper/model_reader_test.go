@@ -0,0 +1,34 @@
+package whisper
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"testing/iotest"
+)
+
+func TestModelReader(t *testing.T) {
+	mr := &modelReader{r: bytes.NewReader([]byte("abcdef"))}
+
+	buf := make([]byte, 4)
+	if n := mr.read(buf); n != 4 || mr.eof {
+		t.Fatalf("read() = %d, eof = %v; want 4, false", n, mr.eof)
+	}
+	if n := mr.read(buf); n != 2 || !mr.eof {
+		t.Fatalf("read() = %d, eof = %v; want 2, true", n, mr.eof)
+	}
+	if mr.err != nil {
+		t.Errorf("err = %v, want nil at end of file", mr.err)
+	}
+}
+
+func TestModelReaderError(t *testing.T) {
+	errBoom := errors.New("boom")
+	mr := &modelReader{r: iotest.ErrReader(errBoom)}
+	if n := mr.read(make([]byte, 8)); n != 0 || !mr.eof {
+		t.Fatalf("read() = %d, eof = %v; want 0, true", n, mr.eof)
+	}
+	if !errors.Is(mr.err, errBoom) {
+		t.Errorf("err = %v, want %v", mr.err, errBoom)
+	}
+}
@@ -0,0 +1,148 @@
+//go:build linux || darwin || windows
+
+package whisper
+
+/*
+#include "whisper_cgo.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/cgo"
+	"sync"
+	"sync/atomic"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+)
+
+// transcribeParallel splits samples at silence into opts.ParallelChunks parts
+// and decodes them concurrently, each on its own whisper_state with an equal
+// share of the threads. Segments are delivered in order: a chunk's segments
+// are emitted once every earlier chunk has finished. Each state allocates its
+// own buffers, so memory grows with the number of chunks. whisper.cpp only
+// tracks timings for the default state, so Timings is left unset (Runs 0).
+func (c *Context) transcribeParallel(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	// Apply the time range up front; chunk offsets are then added per chunk.
+	start := min(int(opts.Offset*C.WHISPER_SAMPLE_RATE), len(samples))
+	end := len(samples)
+	if opts.Duration > 0 {
+		end = min(end, start+int(opts.Duration*C.WHISPER_SAMPLE_RATE))
+	}
+	base := float64(start) / C.WHISPER_SAMPLE_RATE
+	samples = samples[start:end]
+	opts.Offset, opts.Duration = 0, 0
+
+	bounds := audio.SplitAtSilence(samples, opts.ParallelChunks)
+	n := len(bounds) - 1
+
+	params, cleanup := c.buildFullParams(opts)
+	defer cleanup()
+	threads := opts.Threads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+	params.n_threads = C.int(max(1, threads/n))
+	words := c.wantWords(opts)
+
+	var (
+		mu           sync.Mutex // guards the fields below and serializes cb
+		progress     = make([]int, n)
+		results      = make([][]Segment, n)
+		done         = make([]bool, n)
+		flushed      int
+		lastProgress = -1
+		firstErr     error
+		failed       atomic.Bool
+		wg           sync.WaitGroup
+	)
+	// reportProgress sends the length-weighted mean progress. mu must be held.
+	reportProgress := func() {
+		if cb.OnProgress == nil {
+			return
+		}
+		var sum float64
+		for k := range n {
+			sum += float64(progress[k]) * float64(bounds[k+1]-bounds[k])
+		}
+		if p := int(sum / float64(len(samples))); p != lastProgress {
+			lastProgress = p
+			cb.OnProgress(p)
+		}
+	}
+
+	for k := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workerCB := StreamCallbacks{
+				OnProgress: func(p int) {
+					mu.Lock()
+					defer mu.Unlock()
+					progress[k] = p
+					reportProgress()
+				},
+				ShouldAbort: func() bool {
+					return failed.Load() || (cb.ShouldAbort != nil && cb.ShouldAbort())
+				},
+			}
+			segs, err := c.transcribeWithState(samples[bounds[k]:bounds[k+1]], params, workerCB, words)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				failed.Store(true)
+				return
+			}
+			shift := secondsToCS(base + float64(bounds[k])/C.WHISPER_SAMPLE_RATE)
+			for i := range segs {
+				segs[i] = segs[i].shift(shift)
+			}
+			results[k], done[k] = segs, true
+			progress[k] = 100
+			reportProgress()
+			for flushed < n && done[flushed] {
+				if cb.OnSegment != nil {
+					for _, seg := range results[flushed] {
+						cb.OnSegment(seg)
+					}
+				}
+				flushed++
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return TranscribeResult{}, firstErr
+	}
+
+	var result TranscribeResult
+	for _, segs := range results {
+		result.Segments = append(result.Segments, segs...)
+	}
+	return result, nil
+}
+
+// transcribeWithState decodes samples on a fresh whisper_state so several
+// decodes can share one model concurrently.
+func (c *Context) transcribeWithState(samples []float32, params C.struct_whisper_full_params, cb StreamCallbacks, words bool) ([]Segment, error) {
+	state := C.whisper_init_state(c.ctx)
+	if state == nil {
+		return nil, fmt.Errorf("whisper: failed to allocate decoder state")
+	}
+	defer C.whisper_free_state(state)
+
+	handle := cgo.NewHandle(&cb)
+	defer handle.Delete()
+	C.sona_whisper_set_stream_callbacks(&params, C.uintptr_t(handle))
+
+	ret := C.whisper_full_with_state(c.ctx, state, params, (*C.float)(&samples[0]), C.int(len(samples)))
+	if ret != 0 {
+		return nil, fmt.Errorf("whisper: transcription failed with code %d", ret)
+	}
+	return segmentSource{ctx: c.ctx, state: state}.segments(words), nil
+}
@@ -0,0 +1,108 @@
+//go:build linux || darwin || windows
+
+package whisper
+
+/*
+#include <ggml.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"unsafe"
+
+	"github.com/thewh1teagle/sona/internal/ggml"
+)
+
+// quantizeSkip lists tensors whisper.cpp's quantize tool keeps unquantized.
+var quantizeSkip = map[string]bool{
+	"encoder.conv1.bias":           true,
+	"encoder.conv2.bias":           true,
+	"encoder.positional_embedding": true,
+	"decoder.positional_embedding": true,
+}
+
+// QuantizeModel writes a copy of the model at inPath to outPath with 2D
+// weight tensors quantized to typeName (e.g. "q5_0").
+func QuantizeModel(inPath, outPath, typeName string, progress func(QuantizeProgress)) error {
+	qt, err := ggml.ParseQuantType(typeName)
+	if err != nil {
+		return err
+	}
+	defer C.ggml_quantize_free()
+
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+
+	index := 0
+	ftype := C.GGML_QNT_VERSION*C.GGML_QNT_VERSION_FACTOR + qt.FType
+	err = ggml.TransformModel(in, out, int32(ftype), func(t *ggml.Tensor) error {
+		p := QuantizeProgress{Tensor: t.Name, Index: index, BytesIn: int64(len(t.Data))}
+		quantized, err := quantizeTensor(t, qt.TensorType)
+		if err != nil {
+			return err
+		}
+		p.Quantized = quantized
+		p.BytesOut = int64(len(t.Data))
+		index++
+		if progress != nil {
+			progress(p)
+		}
+		return nil
+	})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("whisper: quantize %s: %w", inPath, err)
+	}
+	return nil
+}
+
+// quantizeTensor converts a 2D f32/f16 tensor to qtype in place. Tensors
+// that are skipped, not 2D, or whose rows do not fit the block size are
+// left unchanged.
+func quantizeTensor(t *ggml.Tensor, qtype int32) (bool, error) {
+	if len(t.Dims) != 2 || quantizeSkip[t.Name] {
+		return false, nil
+	}
+	if t.Type != ggml.TypeF32 && t.Type != ggml.TypeF16 {
+		return false, nil
+	}
+	ctype := C.enum_ggml_type(qtype)
+	nPerRow := int64(t.Dims[0])
+	nRows := int64(t.Dims[1])
+	if nPerRow%int64(C.ggml_blck_size(ctype)) != 0 {
+		return false, nil
+	}
+
+	n := nPerRow * nRows
+	src := make([]float32, n)
+	if t.Type == ggml.TypeF16 {
+		C.ggml_fp16_to_fp32_row((*C.ggml_fp16_t)(unsafe.Pointer(&t.Data[0])), (*C.float)(&src[0]), C.int64_t(n))
+	} else {
+		for i := range src {
+			src[i] = math.Float32frombits(binary.LittleEndian.Uint32(t.Data[i*4:]))
+		}
+	}
+
+	dst := make([]byte, int64(C.ggml_row_size(ctype, C.int64_t(nPerRow)))*nRows)
+	size := C.ggml_quantize_chunk(ctype, (*C.float)(&src[0]), unsafe.Pointer(&dst[0]), 0, C.int64_t(nRows), C.int64_t(nPerRow), nil)
+	if int64(size) != int64(len(dst)) {
+		return false, fmt.Errorf("quantized size %d, expected %d", size, len(dst))
+	}
+	t.Type = qtype
+	t.Data = dst
+	return true, nil
+}
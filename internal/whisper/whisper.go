@@ -2,28 +2,52 @@ package whisper
 
 import (
 	"errors"
+	"math"
 	"strings"
 )
 
 var ErrNotImplemented = errors.New("whisper: not implemented on this platform")
 
+// MaxAudioCtx is the encoder context of every Whisper model, 30s of audio;
+// TranscribeOptions.AudioCtx may only shrink it.
+const MaxAudioCtx = 1500
+
 // TranscribeOptions controls transcription behavior.
 type TranscribeOptions struct {
-	Language         string  // e.g. "en", "he" (empty = whisper.cpp default: "en")
-	DetectLanguage   bool    // auto-detect language (whisper.cpp detect_language)
-	Translate        bool    // translate to English
-	Threads          int     // CPU threads (0 = whisper default)
-	Prompt           string  // initial prompt / vocabulary hint
-	Verbose          bool    // enable whisper/ggml logs
-	Temperature      float32 // initial decoding temperature (0 = whisper default)
-	MaxTextCtx       int     // max tokens from past text as context (0 = whisper default)
-	WordTimestamps   bool    // enable token-level timestamps
-	MaxSegmentLen    int     // max segment length in characters (0 = no limit)
-	SamplingGreedy   bool    // use greedy strategy (default); false = beam search
-	BestOf           int     // greedy: number of top candidates (0 = whisper default)
-	BeamSize         int     // beam search: beam width (0 = whisper default)
-	StableTimestamps bool    // enable VAD-backed timestamp stabilization
-	VadModelPath     string  // path to GGML VAD model (required with StableTimestamps)
+	Language         string   // e.g. "en", "he" (empty = whisper.cpp default: "en")
+	DetectLanguage   bool     // auto-detect language (whisper.cpp detect_language)
+	Translate        bool     // translate to English
+	Threads          int      // CPU threads (0 = whisper default)
+	Prompt           string   // initial prompt / vocabulary hint
+	PromptTokens     []int32  // previous output tokens, decoded as context before Prompt
+	Verbose          bool     // enable whisper/ggml logs
+	Temperature      float32  // initial decoding temperature (0 = whisper default)
+	MaxTextCtx       int      // max tokens from past text as context (0 = whisper default)
+	WordTimestamps   bool     // enable token-level timestamps
+	MaxSegmentLen    int      // max segment length in characters (0 = no limit)
+	SamplingGreedy   bool     // use greedy strategy (default); false = beam search
+	BestOf           int      // greedy: number of top candidates (0 = whisper default)
+	BeamSize         int      // beam search: beam width (0 = whisper default)
+	StableTimestamps bool     // enable VAD-backed timestamp stabilization
+	VadModelPath     string   // path to GGML VAD model for StableTimestamps (empty = built-in energy VAD)
+	Hotwords         []string // words/phrases to bias decoding towards
+	HotwordBoost     float32  // logit boost for hotword tokens (0 = default)
+	SuppressWords    []string // words/phrases to never emit
+	SuppressRegex    string   // regex of tokens to suppress (whisper.cpp suppress_regex)
+	Offset           float64  // seconds into samples to start decoding (0 = start)
+	Duration         float64  // seconds of audio to decode after Offset (0 = until end)
+	TimeOffset       float64  // source time of samples[0] in seconds, added to all timestamps
+	AudioCtx         int      // encoder audio context size (0 = model default; smaller is faster)
+	SingleSegment    bool     // force a single output segment (useful for short dictation)
+	ParallelChunks   int      // split at silence and decode this many chunks concurrently (0/1 = off)
+}
+
+// ContextOptions controls how a model is loaded.
+type ContextOptions struct {
+	GPUDevice int    // GPU device index (-1 = whisper default)
+	NoGPU     bool   // force CPU inference
+	FlashAttn bool   // enable flash attention
+	DTW       string // DTW alignment-heads preset for token timestamps ("auto" = from model type, "" = off)
 }
 
 // Segment represents a transcribed text segment with timestamps.
@@ -31,11 +55,78 @@ type Segment struct {
 	Start int64 // start time in centiseconds (10ms units)
 	End   int64 // end time in centiseconds (10ms units)
 	Text  string
+	Words []Word // set with WordTimestamps or a DTW-enabled model
+	// Channel is the 1-based source channel when channels are transcribed
+	// separately (see TranscribeChannels), or 0 for mixed audio.
+	Channel int
+}
+
+// Word is a word assembled from whisper tokens, with timestamps.
+type Word struct {
+	Start       int64 // start time in centiseconds (10ms units)
+	End         int64 // end time in centiseconds (10ms units)
+	Text        string
+	Probability float32 // mean token probability
+}
+
+// shift returns the segment moved later by cs centiseconds.
+func (s Segment) shift(cs int64) Segment {
+	s.Start += cs
+	s.End += cs
+	if s.Words != nil {
+		words := make([]Word, len(s.Words))
+		for i, w := range s.Words {
+			w.Start += cs
+			w.End += cs
+			words[i] = w
+		}
+		s.Words = words
+	}
+	return s
+}
+
+// secondsToCS converts seconds to whisper centiseconds (10ms units).
+func secondsToCS(s float64) int64 {
+	return int64(math.Round(s * 100))
+}
+
+// Timings reports whisper.cpp's average time per call of each inference
+// stage, in milliseconds, as whisper_get_timings does: EncodeAvgMs is the
+// mean time of one encoder pass, not the time spent encoding. whisper.cpp
+// does not expose the call counts, so totals cannot be derived. Runs is the
+// number of whisper_full runs averaged; 0 means no timings are available.
+type Timings struct {
+	SampleAvgMs float64
+	EncodeAvgMs float64
+	DecodeAvgMs float64
+	BatchdAvgMs float64
+	PromptAvgMs float64
+	Runs        int
+}
+
+// merge averages t and o, weighted by their runs.
+func (t Timings) merge(o Timings) Timings {
+	n := t.Runs + o.Runs
+	if n == 0 {
+		return Timings{}
+	}
+	mean := func(a, b float64) float64 {
+		return (a*float64(t.Runs) + b*float64(o.Runs)) / float64(n)
+	}
+	return Timings{
+		SampleAvgMs: mean(t.SampleAvgMs, o.SampleAvgMs),
+		EncodeAvgMs: mean(t.EncodeAvgMs, o.EncodeAvgMs),
+		DecodeAvgMs: mean(t.DecodeAvgMs, o.DecodeAvgMs),
+		BatchdAvgMs: mean(t.BatchdAvgMs, o.BatchdAvgMs),
+		PromptAvgMs: mean(t.PromptAvgMs, o.PromptAvgMs),
+		Runs:        n,
+	}
 }
 
 // TranscribeResult holds the output of a transcription.
 type TranscribeResult struct {
 	Segments []Segment
+	Timings  Timings
 }
 
 // Text returns the concatenated text of all segments.
@@ -55,4 +146,15 @@ type StreamCallbacks struct {
 	OnSegment func(segment Segment)
 	// ShouldAbort is polled during inference; return true to cancel.
 	ShouldAbort func() bool
+
+	words bool // collect per-segment words for OnSegment
+}
+
+// QuantizeProgress is reported once per tensor by QuantizeModel.
+type QuantizeProgress struct {
+	Tensor    string
+	Index     int  // zero-based tensor index
+	Quantized bool // false when the tensor was copied unchanged
+	BytesIn   int64
+	BytesOut  int64
 }
@@ -22,19 +22,17 @@ func sonaGoProgressCB(handle uintptr, progress int32) {
 }
 
 //export sonaGoSegmentCB
-func sonaGoSegmentCB(handle uintptr, ctxPtr unsafe.Pointer, nNew int32) {
+func sonaGoSegmentCB(handle uintptr, ctxPtr, statePtr unsafe.Pointer, nNew int32) {
 	h := cgo.Handle(handle)
 	cb := h.Value().(*StreamCallbacks)
 	if cb.OnSegment != nil {
-		ctx := (*C.struct_whisper_context)(ctxPtr)
-		nSegments := int(C.whisper_full_n_segments(ctx))
+		src := segmentSource{
+			ctx:   (*C.struct_whisper_context)(ctxPtr),
+			state: (*C.struct_whisper_state)(statePtr),
+		}
+		nSegments := src.n()
 		for i := nSegments - int(nNew); i < nSegments; i++ {
-			seg := Segment{
-				Start: int64(C.whisper_full_get_segment_t0(ctx, C.int(i))),
-				End:   int64(C.whisper_full_get_segment_t1(ctx, C.int(i))),
-				Text:  C.GoString(C.whisper_full_get_segment_text(ctx, C.int(i))),
-			}
-			cb.OnSegment(seg)
+			cb.OnSegment(src.segment(i, cb.words))
 		}
 	}
 }
@@ -48,3 +46,37 @@ func sonaGoAbortCB(handle uintptr) int32 {
 	}
 	return 0
 }
+
+//export sonaGoLogitsFilterCB
+func sonaGoLogitsFilterCB(handle uintptr, tokens unsafe.Pointer, nTokens int32, logits *C.float, nVocab int32) {
+	h := cgo.Handle(handle)
+	f := h.Value().(*logitsFilter)
+	history := make([]int32, nTokens)
+	if nTokens > 0 {
+		data := unsafe.Slice((*C.whisper_token_data)(tokens), nTokens)
+		for i := range data {
+			history[i] = int32(data[i].id)
+		}
+	}
+	f.apply(history, unsafe.Slice((*float32)(unsafe.Pointer(logits)), nVocab))
+}
+
+//export sonaGoLoaderRead
+func sonaGoLoaderRead(handle uintptr, output unsafe.Pointer, readSize C.size_t) C.size_t {
+	h := cgo.Handle(handle)
+	mr := h.Value().(*modelReader)
+	if readSize == 0 {
+		return 0
+	}
+	return C.size_t(mr.read(unsafe.Slice((*byte)(output), int(readSize))))
+}
+
+//export sonaGoLoaderEOF
+func sonaGoLoaderEOF(handle uintptr) int32 {
+	h := cgo.Handle(handle)
+	mr := h.Value().(*modelReader)
+	if mr.eof {
+		return 1
+	}
+	return 0
+}
@@ -3,8 +3,11 @@
 
 // Forward declarations for Go-exported callback trampolines.
 extern void sonaGoProgressCB(uintptr_t handle, int32_t progress);
-extern void sonaGoSegmentCB(uintptr_t handle, void *ctx_ptr, int32_t n_new);
+extern void sonaGoSegmentCB(uintptr_t handle, void *ctx_ptr, void *state_ptr, int32_t n_new);
 extern int32_t sonaGoAbortCB(uintptr_t handle);
+extern void sonaGoLogitsFilterCB(uintptr_t handle, void *tokens, int32_t n_tokens, float *logits, int32_t n_vocab);
+extern size_t sonaGoLoaderRead(uintptr_t handle, void *output, size_t read_size);
+extern int32_t sonaGoLoaderEOF(uintptr_t handle);
 
 static int sona_whisper_verbose = 0;
 
@@ -28,8 +31,7 @@ static void sona_whisper_progress_trampoline(struct whisper_context *ctx, struct
 }
 
 static void sona_whisper_new_segment_trampoline(struct whisper_context *ctx, struct whisper_state *state, int n_new, void *user_data) {
-    (void)state;
-    sonaGoSegmentCB((uintptr_t)user_data, ctx, (int32_t)n_new);
+    sonaGoSegmentCB((uintptr_t)user_data, ctx, state, (int32_t)n_new);
 }
 
 static _Bool sona_whisper_abort_trampoline(void *user_data) {
@@ -46,6 +48,40 @@ void sona_whisper_set_stream_callbacks(struct whisper_full_params *params, uintp
     params->abort_callback_user_data = h;
 }
 
+static void sona_whisper_logits_filter_trampoline(struct whisper_context *ctx, struct whisper_state *state, const whisper_token_data *tokens, int n_tokens, float *logits, void *user_data) {
+    (void)state;
+    sonaGoLogitsFilterCB((uintptr_t)user_data, (void *)tokens, (int32_t)n_tokens, logits, (int32_t)whisper_n_vocab(ctx));
+}
+
+void sona_whisper_set_logits_filter(struct whisper_full_params *params, uintptr_t handle) {
+    params->logits_filter_callback = sona_whisper_logits_filter_trampoline;
+    params->logits_filter_callback_user_data = (void *)handle;
+}
+
+// Model loading from a Go reader via whisper_model_loader.
+
+static size_t sona_loader_read(void *ctx, void *output, size_t read_size) {
+    return sonaGoLoaderRead((uintptr_t)ctx, output, read_size);
+}
+
+static bool sona_loader_eof(void *ctx) {
+    return sonaGoLoaderEOF((uintptr_t)ctx) != 0;
+}
+
+static void sona_loader_close(void *ctx) {
+    (void)ctx; // the Go side owns and closes the file
+}
+
+struct whisper_context *sona_whisper_init_from_reader(uintptr_t handle, struct whisper_context_params params) {
+    whisper_model_loader loader = {
+        .context = (void *)handle,
+        .read = sona_loader_read,
+        .eof = sona_loader_eof,
+        .close = sona_loader_close,
+    };
+    return whisper_init_with_params(&loader, params);
+}
+
 // GPU device enumeration via ggml backend API.
 
 int sona_gpu_device_count(void) {
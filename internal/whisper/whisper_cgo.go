@@ -10,14 +10,38 @@ package whisper
 import "C"
 
 import (
+	"bufio"
 	"fmt"
+	"math"
 	"os"
 	"runtime/cgo"
+	"strings"
 	"unsafe"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+	"github.com/thewh1teagle/sona/internal/ggml"
 )
 
+// dtwAheadsPresets maps DTWPresets names to whisper.cpp alignment heads.
+var dtwAheadsPresets = map[string]C.enum_whisper_alignment_heads_preset{
+	"tiny.en":        C.WHISPER_AHEADS_TINY_EN,
+	"tiny":           C.WHISPER_AHEADS_TINY,
+	"base.en":        C.WHISPER_AHEADS_BASE_EN,
+	"base":           C.WHISPER_AHEADS_BASE,
+	"small.en":       C.WHISPER_AHEADS_SMALL_EN,
+	"small":          C.WHISPER_AHEADS_SMALL,
+	"medium.en":      C.WHISPER_AHEADS_MEDIUM_EN,
+	"medium":         C.WHISPER_AHEADS_MEDIUM,
+	"large.v1":       C.WHISPER_AHEADS_LARGE_V1,
+	"large.v2":       C.WHISPER_AHEADS_LARGE_V2,
+	"large.v3":       C.WHISPER_AHEADS_LARGE_V3,
+	"large.v3.turbo": C.WHISPER_AHEADS_LARGE_V3_TURBO,
+}
+
 type Context struct {
-	ctx *C.struct_whisper_context
+	ctx  *C.struct_whisper_context
+	opts ContextOptions
+	gpu  bool
 }
 
 func SetVerbose(v bool) {
@@ -28,29 +52,93 @@ func SetVerbose(v bool) {
 	C.sona_whisper_set_verbose(0)
 }
 
-func New(modelPath string, gpuDevice int, noGpu bool) (*Context, error) {
-	// Read model via Go's os.ReadFile which handles non-ASCII paths on Windows
-	// (Go uses CreateFileW internally), then pass the buffer to whisper.cpp
-	// to avoid fopen() failing on non-ASCII paths with MinGW's C runtime.
-	buf, err := os.ReadFile(modelPath)
+func New(modelPath string, opts ContextOptions) (*Context, error) {
+	// Open the model via Go's os.Open which handles non-ASCII paths on Windows
+	// (Go uses CreateFileW internally), then stream it to whisper.cpp through
+	// a whisper_model_loader. This avoids fopen() failing on non-ASCII paths
+	// with MinGW's C runtime without reading the whole model into Go memory.
+	f, err := os.Open(modelPath)
 	if err != nil {
 		return nil, fmt.Errorf("whisper: failed to read model file %s: %w", modelPath, err)
 	}
-	if len(buf) == 0 {
+	defer f.Close()
+	if st, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("whisper: failed to read model file %s: %w", modelPath, err)
+	} else if st.Size() == 0 {
 		return nil, fmt.Errorf("whisper: model file is empty or corrupt: %s", modelPath)
 	}
 
 	params := C.whisper_context_default_params()
-	if noGpu || !VulkanAvailable() {
+	if opts.NoGPU || !VulkanAvailable() {
+		opts.NoGPU = true
 		params.use_gpu = C.bool(false)
-	} else if gpuDevice >= 0 {
-		params.gpu_device = C.int(gpuDevice)
+	} else if opts.GPUDevice >= 0 {
+		params.gpu_device = C.int(opts.GPUDevice)
 	}
-	ctx := C.whisper_init_from_buffer_with_params(unsafe.Pointer(&buf[0]), C.size_t(len(buf)), params)
+	if opts.DTW != "" {
+		preset, err := resolveDTWPreset(modelPath, opts.DTW)
+		if err != nil {
+			return nil, fmt.Errorf("whisper: %w", err)
+		}
+		// whisper.cpp silently drops DTW when flash attention is on.
+		if opts.FlashAttn {
+			return nil, fmt.Errorf("whisper: dtw token timestamps cannot be combined with flash attention")
+		}
+		params.flash_attn = C.bool(false)
+		params.dtw_token_timestamps = C.bool(true)
+		params.dtw_aheads_preset = dtwAheadsPresets[preset]
+		opts.DTW = preset
+	} else if opts.FlashAttn {
+		params.flash_attn = C.bool(true)
+	}
+	opts.FlashAttn = bool(params.flash_attn)
+
+	mr := &modelReader{r: bufio.NewReaderSize(f, 1<<20)}
+	handle := cgo.NewHandle(mr)
+	defer handle.Delete()
+	ctx := C.sona_whisper_init_from_reader(C.uintptr_t(handle), params)
 	if ctx == nil {
+		if mr.err != nil {
+			return nil, fmt.Errorf("whisper: failed to read model file %s: %w", modelPath, mr.err)
+		}
+		// Explain common failures such as truncated downloads or VAD models.
+		if _, inspectErr := ggml.InspectFile(modelPath); inspectErr != nil {
+			return nil, fmt.Errorf("whisper: failed to load model from %s: %w", modelPath, inspectErr)
+		}
 		return nil, fmt.Errorf("whisper: failed to load model from %s", modelPath)
 	}
-	return &Context{ctx: ctx}, nil
+	return &Context{ctx: ctx, opts: opts, gpu: !opts.NoGPU && len(ListGPUDevices()) > 0}, nil
+}
+
+// UsesGPU reports whether inference runs on a GPU backend rather than the CPU.
+func (c *Context) UsesGPU() bool {
+	return c.gpu
+}
+
+// ModelInfo reports the loaded model's architecture.
+func (c *Context) ModelInfo() ggml.ModelInfo {
+	info := ggml.NewModelInfo(ggml.Hparams{
+		NVocab:      int32(C.whisper_model_n_vocab(c.ctx)),
+		NAudioCtx:   int32(C.whisper_model_n_audio_ctx(c.ctx)),
+		NAudioState: int32(C.whisper_model_n_audio_state(c.ctx)),
+		NAudioHead:  int32(C.whisper_model_n_audio_head(c.ctx)),
+		NAudioLayer: int32(C.whisper_model_n_audio_layer(c.ctx)),
+		NTextCtx:    int32(C.whisper_model_n_text_ctx(c.ctx)),
+		NTextState:  int32(C.whisper_model_n_text_state(c.ctx)),
+		NTextHead:   int32(C.whisper_model_n_text_head(c.ctx)),
+		NTextLayer:  int32(C.whisper_model_n_text_layer(c.ctx)),
+		NMels:       int32(C.whisper_model_n_mels(c.ctx)),
+		FType:       int32(C.whisper_model_ftype(c.ctx)),
+	})
+	info.Type = C.GoString(C.whisper_model_type_readable(c.ctx))
+	info.Multilingual = C.whisper_is_multilingual(c.ctx) != 0
+	return info
+}
+
+// Options returns the options the model was loaded with. NoGPU is true
+// whenever inference falls back to the CPU.
+func (c *Context) Options() ContextOptions {
+	return c.opts
 }
 
 // Transcribe runs inference and returns all segments with timestamps.
@@ -66,12 +154,69 @@ func (c *Context) TranscribeStream(samples []float32, opts TranscribeOptions, cb
 	if len(samples) == 0 {
 		return TranscribeResult{}, fmt.Errorf("whisper: no samples")
 	}
-	if opts.StableTimestamps {
-		return c.transcribeStableTimestamps(samples, opts, cb)
+	if opts.Offset < 0 || opts.Duration < 0 || opts.TimeOffset < 0 {
+		return TranscribeResult{}, fmt.Errorf("whisper: offset and duration must not be negative")
+	}
+	if int(opts.Offset*C.WHISPER_SAMPLE_RATE) >= len(samples) {
+		return TranscribeResult{}, fmt.Errorf("whisper: offset %.2fs is beyond the end of the audio", opts.Offset)
+	}
+
+	// Report timestamps relative to the source audio, not the samples buffer.
+	shift := secondsToCS(opts.TimeOffset)
+	if shift != 0 && cb.OnSegment != nil {
+		onSegment := cb.OnSegment
+		cb.OnSegment = func(seg Segment) { onSegment(seg.shift(shift)) }
+	}
+
+	C.whisper_reset_timings(c.ctx)
+
+	var result TranscribeResult
+	var err error
+	switch {
+	case opts.StableTimestamps && opts.ParallelChunks > 1:
+		return TranscribeResult{}, fmt.Errorf("whisper: parallel chunks cannot be combined with stable timestamps")
+	case opts.StableTimestamps:
+		result, err = c.transcribeStableTimestamps(samples, opts, cb)
+	case opts.ParallelChunks > 1:
+		result, err = c.transcribeParallel(samples, opts, cb)
+	default:
+		result, err = c.transcribe(samples, opts, cb)
+	}
+	if err != nil {
+		return TranscribeResult{}, err
+	}
+	for i := range result.Segments {
+		result.Segments[i] = result.Segments[i].shift(shift)
+	}
+	if opts.ParallelChunks <= 1 {
+		result.Timings = c.timings()
+	}
+	return result, nil
+}
+
+// timings returns whisper.cpp's per-call stage averages since the last
+// reset, for one run.
+func (c *Context) timings() Timings {
+	t := C.whisper_get_timings(c.ctx)
+	if t == nil {
+		return Timings{}
+	}
+	defer C.sona_whisper_free_timings(t)
+	return Timings{
+		SampleAvgMs: float64(t.sample_ms),
+		EncodeAvgMs: float64(t.encode_ms),
+		DecodeAvgMs: float64(t.decode_ms),
+		BatchdAvgMs: float64(t.batchd_ms),
+		PromptAvgMs: float64(t.prompt_ms),
+		Runs:        1,
 	}
+}
 
-	params, cleanup := buildFullParams(opts)
+func (c *Context) transcribe(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	params, cleanup := c.buildFullParams(opts)
 	defer cleanup()
+	words := c.wantWords(opts)
+	cb.words = words
 
 	// Set up streaming callbacks if any are provided.
 	hasCallbacks := cb.OnProgress != nil || cb.OnSegment != nil || cb.ShouldAbort != nil
@@ -87,10 +232,15 @@ func (c *Context) TranscribeStream(samples []float32, opts TranscribeOptions, cb
 		return TranscribeResult{}, fmt.Errorf("whisper: transcription failed with code %d", ret)
 	}
 
-	return TranscribeResult{Segments: collectSegments(c.ctx)}, nil
+	return TranscribeResult{Segments: collectSegments(c.ctx, words)}, nil
+}
+
+// wantWords reports whether segments should carry word timestamps.
+func (c *Context) wantWords(opts TranscribeOptions) bool {
+	return opts.WordTimestamps || c.opts.DTW != ""
 }
 
-func buildFullParams(opts TranscribeOptions) (C.struct_whisper_full_params, func()) {
+func (c *Context) buildFullParams(opts TranscribeOptions) (C.struct_whisper_full_params, func()) {
 	strategy := C.enum_whisper_sampling_strategy(C.WHISPER_SAMPLING_GREEDY)
 	if !opts.SamplingGreedy && opts.BeamSize > 0 {
 		strategy = C.enum_whisper_sampling_strategy(C.WHISPER_SAMPLING_BEAM_SEARCH)
@@ -116,7 +266,22 @@ func buildFullParams(opts TranscribeOptions) (C.struct_whisper_full_params, func
 	if opts.Threads > 0 {
 		params.n_threads = C.int(opts.Threads)
 	}
-	if opts.Prompt != "" {
+	if len(opts.PromptTokens) > 0 {
+		// whisper.cpp replaces prompt_tokens with initial_prompt, so pass
+		// both as one token list with the prompt closest to the audio.
+		tokens := opts.PromptTokens
+		if opts.Prompt != "" {
+			tokens = append(append([]int32(nil), tokens...), c.Tokenize(opts.Prompt)...)
+		}
+		cTokens := (*C.whisper_token)(C.malloc(C.size_t(len(tokens)) * C.size_t(unsafe.Sizeof(C.whisper_token(0)))))
+		cPtrs = append(cPtrs, unsafe.Pointer(cTokens))
+		cSlice := unsafe.Slice(cTokens, len(tokens))
+		for i, tok := range tokens {
+			cSlice[i] = C.whisper_token(tok)
+		}
+		params.prompt_tokens = cTokens
+		params.prompt_n_tokens = C.int(len(tokens))
+	} else if opts.Prompt != "" {
 		cPrompt := C.CString(opts.Prompt)
 		cPtrs = append(cPtrs, unsafe.Pointer(cPrompt))
 		params.initial_prompt = cPrompt
@@ -133,43 +298,196 @@ func buildFullParams(opts TranscribeOptions) (C.struct_whisper_full_params, func
 	if opts.MaxSegmentLen > 0 {
 		params.max_len = C.int(opts.MaxSegmentLen)
 	}
+	if opts.Offset > 0 {
+		params.offset_ms = C.int(opts.Offset * 1000)
+	}
+	if opts.Duration > 0 {
+		params.duration_ms = C.int(opts.Duration * 1000)
+	}
+	if opts.AudioCtx > 0 {
+		params.audio_ctx = C.int(opts.AudioCtx)
+	}
+	if opts.SingleSegment {
+		params.single_segment = C.bool(true)
+	}
 	if opts.BestOf > 0 {
 		params.greedy.best_of = C.int(opts.BestOf)
 	}
 	if opts.BeamSize > 0 {
 		params.beam_search.beam_size = C.int(opts.BeamSize)
 	}
+	if opts.SuppressRegex != "" {
+		cRegex := C.CString(opts.SuppressRegex)
+		cPtrs = append(cPtrs, unsafe.Pointer(cRegex))
+		params.suppress_regex = cRegex
+	}
+
+	var filterHandle cgo.Handle
+	if filter := c.newLogitsFilter(opts); filter != nil {
+		filterHandle = cgo.NewHandle(filter)
+		C.sona_whisper_set_logits_filter(&params, C.uintptr_t(filterHandle))
+	}
 
 	cleanup := func() {
 		for _, ptr := range cPtrs {
 			C.free(ptr)
 		}
+		if filterHandle != 0 {
+			filterHandle.Delete()
+		}
 	}
 	return params, cleanup
 }
 
-func collectSegments(ctx *C.struct_whisper_context) []Segment {
-	nSegments := int(C.whisper_full_n_segments(ctx))
-	segments := make([]Segment, nSegments)
-	for i := 0; i < nSegments; i++ {
-		segments[i] = Segment{
-			Start: int64(C.whisper_full_get_segment_t0(ctx, C.int(i))),
-			End:   int64(C.whisper_full_get_segment_t1(ctx, C.int(i))),
-			Text:  C.GoString(C.whisper_full_get_segment_text(ctx, C.int(i))),
+// newLogitsFilter tokenizes the hotword and suppress lists for the loaded
+// model. Returns nil when neither list yields any tokens.
+func (c *Context) newLogitsFilter(opts TranscribeOptions) *logitsFilter {
+	f := &logitsFilter{boost: opts.HotwordBoost, special: int32(C.whisper_token_eot(c.ctx))}
+	if f.boost == 0 {
+		f.boost = defaultHotwordBoost
+	}
+	for _, word := range opts.Hotwords {
+		f.hotwords = append(f.hotwords, c.tokenizeWord(word)...)
+	}
+	for _, word := range opts.SuppressWords {
+		f.suppress = append(f.suppress, c.tokenizeWord(word)...)
+	}
+	if len(f.hotwords) == 0 && len(f.suppress) == 0 {
+		return nil
+	}
+	return f
+}
+
+// tokenizeWord returns the token sequences for a word: with a leading space,
+// as whisper encodes it mid-sentence, and without, for the start of a
+// segment.
+func (c *Context) tokenizeWord(word string) []tokenSeq {
+	word = strings.TrimSpace(word)
+	if word == "" {
+		return nil
+	}
+	var seqs []tokenSeq
+	for _, variant := range []string{" " + word, word} {
+		if tokens := c.Tokenize(variant); len(tokens) > 0 {
+			seqs = append(seqs, tokenSeq{tokens: tokens, atStart: variant == word})
 		}
 	}
+	return seqs
+}
+
+// Tokenize converts text to the model's token ids.
+func (c *Context) Tokenize(text string) []int32 {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	// BPE never yields more tokens than input bytes.
+	buf := make([]C.whisper_token, len(text)+1)
+	n := int(C.whisper_tokenize(c.ctx, cText, &buf[0], C.int(len(buf))))
+	if n <= 0 {
+		return nil
+	}
+	tokens := make([]int32, n)
+	for i := 0; i < n; i++ {
+		tokens[i] = int32(buf[i])
+	}
+	return tokens
+}
+
+func collectSegments(ctx *C.struct_whisper_context, words bool) []Segment {
+	return segmentSource{ctx: ctx}.segments(words)
+}
+
+// segmentSource reads decoded segments from the context's default state, or
+// from state when it is set (whisper_full_with_state).
+type segmentSource struct {
+	ctx   *C.struct_whisper_context
+	state *C.struct_whisper_state
+}
+
+func (src segmentSource) n() int {
+	if src.state != nil {
+		return int(C.whisper_full_n_segments_from_state(src.state))
+	}
+	return int(C.whisper_full_n_segments(src.ctx))
+}
+
+func (src segmentSource) segments(words bool) []Segment {
+	segments := make([]Segment, src.n())
+	for i := range segments {
+		segments[i] = src.segment(i, words)
+	}
 	return segments
 }
 
-func (c *Context) transcribeStableTimestamps(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
-	if opts.VadModelPath == "" {
-		return TranscribeResult{}, fmt.Errorf("whisper: vad_model is required when stable timestamps are enabled")
+func (src segmentSource) segment(i int, words bool) Segment {
+	var seg Segment
+	if src.state != nil {
+		seg = Segment{
+			Start: int64(C.whisper_full_get_segment_t0_from_state(src.state, C.int(i))),
+			End:   int64(C.whisper_full_get_segment_t1_from_state(src.state, C.int(i))),
+			Text:  C.GoString(C.whisper_full_get_segment_text_from_state(src.state, C.int(i))),
+		}
+	} else {
+		seg = Segment{
+			Start: int64(C.whisper_full_get_segment_t0(src.ctx, C.int(i))),
+			End:   int64(C.whisper_full_get_segment_t1(src.ctx, C.int(i))),
+			Text:  C.GoString(C.whisper_full_get_segment_text(src.ctx, C.int(i))),
+		}
+	}
+	if words {
+		seg.Words = assembleWords(src.tokens(i), seg.End)
+	}
+	return seg
+}
+
+// tokens returns the text tokens of segment i, skipping special and
+// timestamp tokens.
+func (src segmentSource) tokens(i int) []tokenTiming {
+	eot := C.whisper_token_eot(src.ctx)
+	var n int
+	if src.state != nil {
+		n = int(C.whisper_full_n_tokens_from_state(src.state, C.int(i)))
+	} else {
+		n = int(C.whisper_full_n_tokens(src.ctx, C.int(i)))
+	}
+	tokens := make([]tokenTiming, 0, n)
+	for j := 0; j < n; j++ {
+		var data C.whisper_token_data
+		var text *C.char
+		if src.state != nil {
+			data = C.whisper_full_get_token_data_from_state(src.state, C.int(i), C.int(j))
+			text = C.whisper_full_get_token_text_from_state(src.ctx, src.state, C.int(i), C.int(j))
+		} else {
+			data = C.whisper_full_get_token_data(src.ctx, C.int(i), C.int(j))
+			text = C.whisper_full_get_token_text(src.ctx, C.int(i), C.int(j))
+		}
+		if data.id >= eot {
+			continue
+		}
+		tokens = append(tokens, tokenTiming{
+			Text: C.GoString(text),
+			T0:   int64(data.t0),
+			T1:   int64(data.t1),
+			TDTW: int64(data.t_dtw),
+			P:    float32(data.p),
+		})
 	}
+	return tokens
+}
 
-	params, cleanup := buildFullParams(opts)
+func (c *Context) transcribeStableTimestamps(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	params, cleanup := c.buildFullParams(opts)
 	defer cleanup()
 	params.vad = C.bool(false)
 	params.vad_model_path = nil
+	// The time range is applied to the VAD segments instead of each decode.
+	params.offset_ms = 0
+	params.duration_ms = 0
+	windowStart := secondsToCS(opts.Offset)
+	windowEnd := int64(math.MaxInt64)
+	if opts.Duration > 0 {
+		windowEnd = secondsToCS(opts.Offset + opts.Duration)
+	}
 
 	// Keep abort support active during segment decode without emitting raw callbacks.
 	if cb.ShouldAbort != nil {
@@ -179,39 +497,26 @@ func (c *Context) transcribeStableTimestamps(samples []float32, opts TranscribeO
 		C.sona_whisper_set_stream_callbacks(&params, C.uintptr_t(handle))
 	}
 
-	cVadModelPath := C.CString(opts.VadModelPath)
-	defer C.free(unsafe.Pointer(cVadModelPath))
-
-	vadCtxParams := C.whisper_vad_default_context_params()
-	vctx := C.whisper_vad_init_from_file_with_params(cVadModelPath, vadCtxParams)
-	if vctx == nil {
-		return TranscribeResult{}, fmt.Errorf("whisper: failed to load VAD model from %s", opts.VadModelPath)
-	}
-	defer C.whisper_vad_free(vctx)
-
-	vadParams := C.whisper_vad_default_params()
-	vadSegments := C.whisper_vad_segments_from_samples(vctx, vadParams, (*C.float)(&samples[0]), C.int(len(samples)))
-	if vadSegments == nil {
-		return TranscribeResult{}, fmt.Errorf("whisper: failed to run VAD segmentation")
+	speech, err := speechRegions(samples, opts.VadModelPath)
+	if err != nil {
+		return TranscribeResult{}, err
 	}
-	defer C.whisper_vad_free_segments(vadSegments)
-
-	nVadSegments := int(C.whisper_vad_segments_n_segments(vadSegments))
-	if nVadSegments == 0 {
+	if len(speech) == 0 {
 		if cb.OnProgress != nil {
 			cb.OnProgress(100)
 		}
 		return TranscribeResult{Segments: []Segment{}}, nil
 	}
 
-	result := TranscribeResult{Segments: make([]Segment, 0, nVadSegments)}
-	for i := 0; i < nVadSegments; i++ {
+	result := TranscribeResult{Segments: make([]Segment, 0, len(speech))}
+	for i, region := range speech {
 		if cb.ShouldAbort != nil && cb.ShouldAbort() {
 			return TranscribeResult{}, fmt.Errorf("whisper: transcription aborted")
 		}
 
-		t0cs := int64(C.whisper_vad_segments_get_segment_t0(vadSegments, C.int(i)))
-		t1cs := int64(C.whisper_vad_segments_get_segment_t1(vadSegments, C.int(i)))
+		t0cs, t1cs := region[0], region[1]
+		t0cs = max(t0cs, windowStart)
+		t1cs = min(t1cs, windowEnd)
 		if t1cs <= t0cs {
 			continue
 		}
@@ -233,11 +538,9 @@ func (c *Context) transcribeStableTimestamps(samples []float32, opts TranscribeO
 			return TranscribeResult{}, fmt.Errorf("whisper: transcription failed with code %d", ret)
 		}
 
-		decoded := collectSegments(c.ctx)
+		decoded := collectSegments(c.ctx, c.wantWords(opts))
 		for _, seg := range decoded {
-			shifted := seg
-			shifted.Start += t0cs
-			shifted.End += t0cs
+			shifted := seg.shift(t0cs)
 			result.Segments = append(result.Segments, shifted)
 			if cb.OnSegment != nil {
 				cb.OnSegment(shifted)
@@ -245,13 +548,52 @@ func (c *Context) transcribeStableTimestamps(samples []float32, opts TranscribeO
 		}
 
 		if cb.OnProgress != nil {
-			cb.OnProgress((i + 1) * 100 / nVadSegments)
+			cb.OnProgress((i + 1) * 100 / len(speech))
 		}
 	}
 
 	return result, nil
 }
 
+// speechRegions returns the speech in samples as centisecond ranges, found
+// by the GGML VAD model at vadModelPath, or by audio.DetectSpeech if it is
+// empty.
+func speechRegions(samples []float32, vadModelPath string) ([][2]int64, error) {
+	if vadModelPath == "" {
+		var regions [][2]int64
+		for _, seg := range audio.DetectSpeech(samples, audio.VADOptions{}) {
+			regions = append(regions, [2]int64{secondsToCS(seg.Start), secondsToCS(seg.End)})
+		}
+		return regions, nil
+	}
+
+	cVadModelPath := C.CString(vadModelPath)
+	defer C.free(unsafe.Pointer(cVadModelPath))
+
+	vadCtxParams := C.whisper_vad_default_context_params()
+	vctx := C.whisper_vad_init_from_file_with_params(cVadModelPath, vadCtxParams)
+	if vctx == nil {
+		return nil, fmt.Errorf("whisper: failed to load VAD model from %s", vadModelPath)
+	}
+	defer C.whisper_vad_free(vctx)
+
+	vadParams := C.whisper_vad_default_params()
+	vadSegments := C.whisper_vad_segments_from_samples(vctx, vadParams, (*C.float)(&samples[0]), C.int(len(samples)))
+	if vadSegments == nil {
+		return nil, fmt.Errorf("whisper: failed to run VAD segmentation")
+	}
+	defer C.whisper_vad_free_segments(vadSegments)
+
+	regions := make([][2]int64, int(C.whisper_vad_segments_n_segments(vadSegments)))
+	for i := range regions {
+		regions[i] = [2]int64{
+			int64(C.whisper_vad_segments_get_segment_t0(vadSegments, C.int(i))),
+			int64(C.whisper_vad_segments_get_segment_t1(vadSegments, C.int(i))),
+		}
+	}
+	return regions, nil
+}
+
 func (c *Context) Close() {
 	if c.ctx != nil {
 		C.whisper_free(c.ctx)
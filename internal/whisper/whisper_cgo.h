@@ -5,6 +5,16 @@
 
 void sona_whisper_set_verbose(int verbose);
 void sona_whisper_set_stream_callbacks(struct whisper_full_params *params, uintptr_t handle);
+void sona_whisper_set_logits_filter(struct whisper_full_params *params, uintptr_t handle);
+struct whisper_context *sona_whisper_init_from_reader(uintptr_t handle, struct whisper_context_params params);
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+void sona_whisper_free_timings(struct whisper_timings *t);
+#ifdef __cplusplus
+}
+#endif
 
 // GPU device enumeration via ggml backend API.
 int sona_gpu_device_count(void);
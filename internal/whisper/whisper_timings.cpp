@@ -0,0 +1,9 @@
+//go:build linux || darwin || windows
+
+#include "whisper_cgo.h"
+
+// whisper_get_timings allocates its result with new, so it must be released
+// with delete rather than free.
+extern "C" void sona_whisper_free_timings(struct whisper_timings *t) {
+    delete t;
+}
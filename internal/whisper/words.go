@@ -0,0 +1,101 @@
+package whisper
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/thewh1teagle/sona/internal/ggml"
+)
+
+// tokenTiming is the timing data of one text token in a segment.
+type tokenTiming struct {
+	Text string
+	T0   int64 // token_timestamps start (centiseconds)
+	T1   int64 // token_timestamps end (centiseconds)
+	TDTW int64 // DTW time (centiseconds), -1 when not computed
+	P    float32
+}
+
+// assembleWords joins tokens into words, starting a new word at every token
+// with a leading space. DTW times mark when a token was emitted, so with DTW
+// each word ends where the next one starts and the last at segEnd.
+func assembleWords(tokens []tokenTiming, segEnd int64) []Word {
+	var words []Word
+	var nTokens []int
+	for _, tok := range tokens {
+		start, end := tok.T0, tok.T1
+		if tok.TDTW >= 0 {
+			start, end = tok.TDTW, tok.TDTW
+		}
+		if len(words) == 0 || strings.HasPrefix(tok.Text, " ") {
+			words = append(words, Word{Start: start, End: end, Text: tok.Text, Probability: tok.P})
+			nTokens = append(nTokens, 1)
+			continue
+		}
+		w := &words[len(words)-1]
+		w.Text += tok.Text
+		w.End = end
+		w.Probability += tok.P
+		nTokens[len(nTokens)-1]++
+	}
+
+	dtw := len(tokens) > 0 && tokens[0].TDTW >= 0
+	for i := range words {
+		words[i].Text = strings.TrimSpace(words[i].Text)
+		words[i].Probability /= float32(nTokens[i])
+		if dtw {
+			if i+1 < len(words) {
+				words[i].End = words[i+1].Start
+			} else {
+				words[i].End = max(segEnd, words[i].Start)
+			}
+		}
+	}
+	return words
+}
+
+// DTWPresets lists the alignment-head presets accepted by ContextOptions.DTW,
+// besides "auto".
+var DTWPresets = []string{
+	"tiny.en", "tiny", "base.en", "base", "small.en", "small", "medium.en", "medium",
+	"large.v1", "large.v2", "large.v3", "large.v3.turbo",
+}
+
+// resolveDTWPreset validates a DTW preset name, inferring "auto" from the
+// model file's hyperparameters.
+func resolveDTWPreset(modelPath, name string) (string, error) {
+	if name != "auto" {
+		if !slices.Contains(DTWPresets, name) {
+			return "", fmt.Errorf("unknown dtw preset %q (want auto or one of %s)", name, strings.Join(DTWPresets, ", "))
+		}
+		return name, nil
+	}
+	info, err := ggml.InspectFile(modelPath)
+	if err != nil {
+		return "", err
+	}
+	return inferDTWPreset(info)
+}
+
+// inferDTWPreset picks the DTW alignment-heads preset matching a model.
+// large-v1 and large-v2 share hyperparameters, so both map to large.v2.
+func inferDTWPreset(info ggml.ModelInfo) (string, error) {
+	switch info.Type {
+	case "tiny", "base", "small", "medium":
+		if !info.Multilingual {
+			return info.Type + ".en", nil
+		}
+		return info.Type, nil
+	case "large":
+		switch {
+		case info.NMels == 128 && info.NTextLayer == 4:
+			return "large.v3.turbo", nil
+		case info.NMels == 128:
+			return "large.v3", nil
+		default:
+			return "large.v2", nil
+		}
+	}
+	return "", fmt.Errorf("cannot infer DTW preset for model type %q", info.Type)
+}
@@ -0,0 +1,70 @@
+package whisper
+
+import (
+	"testing"
+
+	"github.com/thewh1teagle/sona/internal/ggml"
+)
+
+func TestAssembleWordsTokenTimestamps(t *testing.T) {
+	tokens := []tokenTiming{
+		{Text: " Hel", T0: 0, T1: 20, TDTW: -1, P: 0.8},
+		{Text: "lo", T0: 20, T1: 40, TDTW: -1, P: 0.6},
+		{Text: " world", T0: 50, T1: 90, TDTW: -1, P: 0.9},
+	}
+	words := assembleWords(tokens, 100)
+	want := []Word{
+		{Start: 0, End: 40, Text: "Hello", Probability: 0.7},
+		{Start: 50, End: 90, Text: "world", Probability: 0.9},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("assembleWords() = %+v, want %+v", words, want)
+	}
+	for i := range want {
+		w := words[i]
+		if w.Start != want[i].Start || w.End != want[i].End || w.Text != want[i].Text ||
+			w.Probability-want[i].Probability > 1e-6 || want[i].Probability-w.Probability > 1e-6 {
+			t.Errorf("word %d = %+v, want %+v", i, w, want[i])
+		}
+	}
+}
+
+func TestAssembleWordsDTW(t *testing.T) {
+	tokens := []tokenTiming{
+		{Text: " one", TDTW: 12},
+		{Text: " two", TDTW: 30},
+		{Text: "s", TDTW: 35},
+	}
+	words := assembleWords(tokens, 60)
+	if len(words) != 2 {
+		t.Fatalf("assembleWords() = %+v, want 2 words", words)
+	}
+	if words[0].Start != 12 || words[0].End != 30 {
+		t.Errorf("first word = %+v, want 12-30", words[0])
+	}
+	if words[1].Text != "twos" || words[1].Start != 30 || words[1].End != 60 {
+		t.Errorf("last word = %+v, want twos 30-60", words[1])
+	}
+}
+
+func TestInferDTWPreset(t *testing.T) {
+	tests := []struct {
+		info ggml.ModelInfo
+		want string
+	}{
+		{ggml.ModelInfo{Type: "tiny", Multilingual: true}, "tiny"},
+		{ggml.ModelInfo{Type: "base"}, "base.en"},
+		{ggml.ModelInfo{Type: "large", Multilingual: true, NMels: 80, NTextLayer: 32}, "large.v2"},
+		{ggml.ModelInfo{Type: "large", Multilingual: true, NMels: 128, NTextLayer: 32}, "large.v3"},
+		{ggml.ModelInfo{Type: "large", Multilingual: true, NMels: 128, NTextLayer: 4}, "large.v3.turbo"},
+	}
+	for _, tt := range tests {
+		got, err := inferDTWPreset(tt.info)
+		if err != nil || got != tt.want {
+			t.Errorf("inferDTWPreset(%+v) = %q, %v, want %q", tt.info, got, err, tt.want)
+		}
+	}
+	if _, err := inferDTWPreset(ggml.ModelInfo{Type: "unknown"}); err == nil {
+		t.Error("inferDTWPreset(unknown) succeeded, want error")
+	}
+}